@@ -1,18 +1,32 @@
 package main
 
 import (
+	"context"
 	"github.com/j94veron/auth-service-insu/internal/config"
+	"github.com/j94veron/auth-service-insu/internal/device"
 	"github.com/j94veron/auth-service-insu/logger"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/apikey"
 	"github.com/j94veron/auth-service-insu/internal/auth"
+	"github.com/j94veron/auth-service-insu/internal/authz"
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/grant"
 	"github.com/j94veron/auth-service-insu/internal/handlers"
+	"github.com/j94veron/auth-service-insu/internal/invitation"
 	"github.com/j94veron/auth-service-insu/internal/middlewares"
 	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/permission"
+	"github.com/j94veron/auth-service-insu/internal/report"
 	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/tenant"
 	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/internal/warehouse"
+	"github.com/j94veron/auth-service-insu/pkg/mailer"
 	"github.com/j94veron/auth-service-insu/pkg/redis"
 	"github.com/j94veron/auth-service-insu/pkg/token"
 	"github.com/joho/godotenv"
@@ -38,7 +52,7 @@ func main() {
 	}
 
 	// Auto-migrate models
-	db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{})
+	db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.FederatedIdentity{}, &models.APIKey{}, &models.Invitation{}, &models.DataScopeRule{}, &models.KnownDevice{}, &models.LoginEvent{}, &models.RoleGrant{}, &models.Report{}, &models.Warehouse{}, &models.Tenant{})
 
 	//Initialize Redis (optional)
 	redisClient := redis.NewClient(
@@ -47,33 +61,181 @@ func main() {
 		0,
 	)
 
+	// Authorization data is cached per replica; changes are broadcast over Redis
+	authzCache := authz.NewCache(redisClient, time.Duration(config.GetEnvInt("AUTHZ_CACHE_TTL_SECONDS", 60))*time.Second)
+	go authzCache.Listen(context.Background())
+
 	// Initialize services and repositories
-	userRepo := user.NewRepository(db)
-	roleRepo := role.NewRepository(db)
+	userRepo := user.WithInvalidation(user.NewRepository(db), authzCache.InvalidateUser)
+	roleRepo := role.WithInvalidation(role.NewRepository(db), authzCache.InvalidateRoles)
+	identityRepo := federation.NewRepository(db)
+	apiKeyRepo := apikey.NewRepository(db)
+	invitationRepo := invitation.NewRepository(db)
+	deviceRepo := device.NewRepository(db)
+	permissionRepo := permission.WithInvalidation(permission.NewRepository(db), authzCache.InvalidateRoles)
+	grantRepo := grant.NewRepository(db)
+	reportRepo := report.NewRepository(db)
+	warehouseRepo := warehouse.NewRepository(db)
+	tenantRepo := tenant.NewRepository(db)
 
 	tokenService := token.NewTokenService(
 		os.Getenv("JWT_ACCESS_SECRET"),
 		os.Getenv("JWT_REFRESH_SECRET"),
 	)
 
-	authService := auth.NewService(userRepo, tokenService, redisClient)
+	// Credential sources, checked in the order given in AUTH_PROVIDERS
+	var authenticators []auth.Authenticator
+	for _, provider := range config.GetEnvList("AUTH_PROVIDERS") {
+		switch provider {
+		case models.AuthProviderLocal:
+			authenticators = append(authenticators, auth.NewLocalAuthenticator(userRepo))
+		case models.AuthProviderLDAP:
+			authenticators = append(authenticators, auth.NewLDAPAuthenticator(auth.LDAPConfig{
+				URL:                os.Getenv("LDAP_URL"),
+				StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+				InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+				BindDN:             os.Getenv("LDAP_BIND_DN"),
+				BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+				BaseDN:             os.Getenv("LDAP_BASE_DN"),
+				UserFilter:         os.Getenv("LDAP_USER_FILTER"),
+				EmailAttribute:     os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+				UsernameAttribute:  os.Getenv("LDAP_USERNAME_ATTRIBUTE"),
+				FirstNameAttribute: os.Getenv("LDAP_FIRST_NAME_ATTRIBUTE"),
+				LastNameAttribute:  os.Getenv("LDAP_LAST_NAME_ATTRIBUTE"),
+				GroupAttribute:     os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+				GroupRoles:         auth.ParseGroupRoles(os.Getenv("LDAP_GROUP_ROLES")),
+				DefaultRole:        os.Getenv("LDAP_DEFAULT_ROLE"),
+			}, userRepo, roleRepo, identityRepo))
+		default:
+			logger.Logger.Error("Unknown auth provider: " + provider)
+		}
+	}
+
+	// Mail is only delivered when an SMTP server is configured
+	var mail mailer.Mailer = mailer.NewLogMailer()
+	if os.Getenv("SMTP_HOST") != "" {
+		mail = mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USER"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("SMTP_FROM"),
+		)
+	}
+
+	// Device tracking and suspicious-login alerts, GeoIP checks need GEOIP_DB_PATH
+	var loginMonitor *device.Usecase
+	if os.Getenv("LOGIN_MONITORING") != "false" {
+		loginMonitor, err = device.NewUsecase(deviceRepo, mail, device.Config{
+			GeoIPPath:         os.Getenv("GEOIP_DB_PATH"),
+			MaxTravelSpeedKmh: float64(config.GetEnvInt("LOGIN_MAX_TRAVEL_SPEED_KMH", 1000)),
+			MinTravelKm:       float64(config.GetEnvInt("LOGIN_MIN_TRAVEL_KM", 500)),
+			StepUpOn:          config.GetEnvList("LOGIN_STEP_UP_ON"),
+		})
+		if err != nil {
+			logger.Logger.Fatal("Error opening GeoIP database: " + err.Error())
+		}
+	}
+
+	authService := auth.NewService(userRepo, tokenService, redisClient, loginMonitor, authenticators...)
+	apiKeyUsecase := apikey.NewUsecase(apiKeyRepo, userRepo)
+
+	magicLinkService := auth.NewMagicLinkService(authService, mail, auth.MagicLinkConfig{
+		AllowedRoles: config.GetEnvList("MAGIC_LINK_ROLES"),
+		TTL:          time.Duration(config.GetEnvInt("MAGIC_LINK_TTL_MINUTES", 15)) * time.Minute,
+		LinkURL:      os.Getenv("MAGIC_LINK_URL"),
+	})
+
+	// Temporary role grants are ended in the background once their window closes
+	grantUsecase := grant.NewUsecase(grantRepo, userRepo, roleRepo, redisClient)
+	go grantUsecase.RunExpiry(context.Background(), time.Duration(config.GetEnvInt("GRANT_EXPIRY_INTERVAL_SECONDS", 60))*time.Second)
+
+	invitationUsecase := invitation.NewUsecase(invitationRepo, userRepo, mail, invitation.Config{
+		TTL:     time.Duration(config.GetEnvInt("INVITATION_TTL_HOURS", 72)) * time.Hour,
+		LinkURL: os.Getenv("INVITATION_URL"),
+	})
+
+	// External OpenID Connect providers, configured as OIDC_{NAME}_* variables
+	var oidcProviders []auth.OIDCProviderConfig
+	for _, name := range config.GetEnvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		oidcProviders = append(oidcProviders, auth.OIDCProviderConfig{
+			Name:          name,
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientID:      os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:  os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:   os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:        config.GetEnvList(prefix + "SCOPES"),
+			AutoProvision: os.Getenv(prefix+"AUTO_PROVISION") == "true",
+			DefaultRole:   os.Getenv(prefix + "DEFAULT_ROLE"),
+		})
+	}
+	oidcService := auth.NewOIDCService(authService, roleRepo, identityRepo, oidcProviders)
+
+	// SAML service provider, only enabled when an IdP is configured
+	var samlService *auth.SAMLService
+	if os.Getenv("SAML_IDP_METADATA_URL") != "" {
+		samlService, err = auth.NewSAMLService(authService, roleRepo, identityRepo, auth.SAMLConfig{
+			ProviderName:   os.Getenv("SAML_PROVIDER_NAME"),
+			EntityID:       os.Getenv("SAML_ENTITY_ID"),
+			RootURL:        os.Getenv("SAML_ROOT_URL"),
+			CertFile:       os.Getenv("SAML_CERT_FILE"),
+			KeyFile:        os.Getenv("SAML_KEY_FILE"),
+			IDPMetadataURL: os.Getenv("SAML_IDP_METADATA_URL"),
+			Attributes: auth.SAMLAttributes{
+				Email:          os.Getenv("SAML_ATTR_EMAIL"),
+				Name:           os.Getenv("SAML_ATTR_NAME"),
+				LastName:       os.Getenv("SAML_ATTR_LAST_NAME"),
+				CommercialZone: os.Getenv("SAML_ATTR_COMMERCIAL_ZONE"),
+				Warehouse:      os.Getenv("SAML_ATTR_WAREHOUSE"),
+				Province:       os.Getenv("SAML_ATTR_PROVINCE"),
+				Groups:         os.Getenv("SAML_ATTR_GROUPS"),
+			},
+			GroupRoles:    auth.ParseGroupRoles(os.Getenv("SAML_GROUP_ROLES")),
+			DefaultRole:   os.Getenv("SAML_DEFAULT_ROLE"),
+			AutoProvision: os.Getenv("SAML_AUTO_PROVISION") == "true",
+		})
+		if err != nil {
+			logger.Logger.Error("Error configuring SAML: " + err.Error())
+		}
+	}
+
+	authzEngine := authz.NewEngine(authzCache.Roles(roleRepo), authzCache.Users(userRepo))
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(userRepo)
-	roleHandler := handlers.NewRoleHandler(roleRepo)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
+	userHandler := handlers.NewUserHandler(userRepo, roleRepo, reportRepo, warehouseRepo, authService)
+	identityHandler := handlers.NewIdentityHandler(identityRepo, userRepo)
+	roleHandler := handlers.NewRoleHandler(roleRepo, permissionRepo, reportRepo)
+	permissionHandler := handlers.NewPermissionHandler(permissionRepo)
+	reportHandler := handlers.NewReportHandler(reportRepo)
+	warehouseHandler := handlers.NewWarehouseHandler(warehouseRepo)
+	tenantHandler := handlers.NewTenantHandler(tenantRepo, userRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyUsecase)
+	meHandler := handlers.NewMeHandler(authService, userRepo, roleRepo)
+	invitationHandler := handlers.NewInvitationHandler(invitationUsecase, roleRepo)
+	roleGrantHandler := handlers.NewRoleGrantHandler(grantUsecase)
+	authorizeHandler := handlers.NewAuthorizeHandler(authzEngine, authService, userRepo)
 
 	// Initialize middlewares
-	authMiddleware := middlewares.NewAuthMiddleware(tokenService, redisClient)
-	permMiddleware := middlewares.NewPermissionMiddleware(userRepo, roleRepo)
+	authMiddleware := middlewares.NewAuthMiddleware(tokenService, redisClient, apiKeyUsecase, authzEngine)
+	permMiddleware := middlewares.NewPermissionMiddleware(authzEngine)
 
 	// Configure router
 	r := gin.Default()
 
+	// The client IP feeds login risk scoring, so X-Forwarded-For is only
+	// trusted from the proxies in TRUSTED_PROXIES; none when it is empty
+	if err := r.SetTrustedProxies(config.GetEnvList("TRUSTED_PROXIES")); err != nil {
+		logger.Logger.Fatal("Error setting trusted proxies: " + err.Error())
+	}
+
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin,Content-Type,Authorization")
 
 		if c.Request.Method == "OPTIONS" {
@@ -86,24 +248,104 @@ func main() {
 
 	// Public routes
 	r.POST("/api/login", authHandler.Login)
+	r.POST("/api/login/verify", authHandler.VerifyStepUp)
 	r.POST("/api/refresh_token", authHandler.Refresh)
+	r.POST("/api/login/magic", magicLinkHandler.Request)
+	r.POST("/api/login/magic/verify", magicLinkHandler.Redeem)
+	r.POST("/api/invitations/accept", invitationHandler.Accept)
+	r.GET("/api/oidc/:provider/login", oidcHandler.Login)
+	r.GET("/api/oidc/:provider/callback", oidcHandler.Callback)
+	if samlService != nil {
+		samlHandler := handlers.NewSAMLHandler(samlService)
+		r.GET("/api/saml/metadata", samlHandler.Metadata)
+		r.GET("/api/saml/login", samlHandler.Login)
+		r.POST("/api/saml/acs", samlHandler.ACS)
+	}
+
+	// Also reachable with the restricted token given to users that must change their password
+	r.PUT("/api/me/password", authMiddleware.AuthRequired(token.ScopePasswordChange), meHandler.ChangePassword)
 
 	// Protected routes
 	api := r.Group("/api", authMiddleware.AuthRequired())
 	{
+		// Own profile, available to every authenticated user
+		api.GET("/me", meHandler.Get)
+		api.PATCH("/me", meHandler.Update)
+		api.POST("/session/warehouse", authHandler.SelectWarehouse)
+		api.GET("/me/role-grants", roleGrantHandler.ListMine)
+		api.POST("/me/role-grants", roleGrantHandler.Request)
+
 		// User
-		api.GET("/users", permMiddleware.HasPermission("/api/users"), userHandler.List)
-		api.GET("/users/:id", permMiddleware.HasPermission("/api/users"), userHandler.GetByID)
-		api.POST("/users", permMiddleware.HasPermission("/api/users"), userHandler.Create)
-		api.PUT("/users/:id", permMiddleware.HasPermission("/api/users"), userHandler.Update)
-		api.DELETE("/users/:id", permMiddleware.HasPermission("/api/users"), userHandler.Delete)
+		api.GET("/users", permMiddleware.HasPermission(), userHandler.List)
+		api.GET("/users/:id", permMiddleware.HasPermission(), userHandler.GetByID)
+		api.POST("/users", permMiddleware.HasPermission(), userHandler.Create)
+		api.PUT("/users/:id", permMiddleware.HasPermission(), userHandler.Update)
+		api.DELETE("/users/:id", permMiddleware.HasPermission(), userHandler.Delete)
+		api.POST("/users/:id/suspend", permMiddleware.HasPermission(), userHandler.Suspend)
+		api.POST("/users/:id/reactivate", permMiddleware.HasPermission(), userHandler.Reactivate)
+		api.GET("/users/:id/identities", permMiddleware.HasPermission(), identityHandler.List)
+		api.POST("/users/:id/identities", permMiddleware.HasPermission(), identityHandler.Link)
+		api.DELETE("/users/:id/identities/:identityId", permMiddleware.HasPermission(), identityHandler.Unlink)
 
 		// Role
-		api.GET("/roles", permMiddleware.HasPermission("/api/roles"), roleHandler.List)
-		api.GET("/roles/:id", permMiddleware.HasPermission("/api/roles"), roleHandler.GetByID)
-		api.POST("/roles", permMiddleware.HasPermission("/api/roles"), roleHandler.Create)
-		api.PUT("/roles/:id", permMiddleware.HasPermission("/api/roles"), roleHandler.Update)
-		api.DELETE("/roles/:id", permMiddleware.HasPermission("/api/roles"), roleHandler.Delete)
+		api.GET("/roles", permMiddleware.HasPermission(), roleHandler.List)
+		api.GET("/roles/:id", permMiddleware.HasPermission(), roleHandler.GetByID)
+		api.POST("/roles", permMiddleware.HasPermission(), roleHandler.Create)
+		api.PUT("/roles/:id", permMiddleware.HasPermission(), roleHandler.Update)
+		api.DELETE("/roles/:id", permMiddleware.HasPermission(), roleHandler.Delete)
+		api.POST("/roles/:id/permissions", permMiddleware.HasPermission(), roleHandler.AddPermissions)
+		api.DELETE("/roles/:id/permissions", permMiddleware.HasPermission(), roleHandler.RemovePermissions)
+		api.PUT("/roles/:id/data-scopes", permMiddleware.HasPermission(), roleHandler.SetDataScopes)
+		api.GET("/roles/:id/effective-permissions", permMiddleware.HasPermission(), roleHandler.EffectivePermissions)
+
+		// Permissions
+		api.GET("/permissions", permMiddleware.HasPermission(), permissionHandler.List)
+		api.GET("/permissions/:id", permMiddleware.HasPermission(), permissionHandler.GetByID)
+		api.POST("/permissions", permMiddleware.HasPermission(), permissionHandler.Create)
+		api.PUT("/permissions/:id", permMiddleware.HasPermission(), permissionHandler.Update)
+		api.DELETE("/permissions/:id", permMiddleware.HasPermission(), permissionHandler.Delete)
+
+		// Tenants, managed from the default tenant only
+		api.GET("/tenants", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), tenantHandler.List)
+		api.GET("/tenants/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), tenantHandler.GetByID)
+		api.POST("/tenants", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), tenantHandler.Create)
+		api.PUT("/tenants/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), tenantHandler.Update)
+		api.DELETE("/tenants/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), tenantHandler.Delete)
+
+		// Reports, shared by every tenant and edited from the default tenant
+		api.GET("/reports", permMiddleware.HasPermission(), reportHandler.List)
+		api.GET("/reports/:id", permMiddleware.HasPermission(), reportHandler.GetByID)
+		api.POST("/reports", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), reportHandler.Create)
+		api.PUT("/reports/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), reportHandler.Update)
+		api.DELETE("/reports/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), reportHandler.Delete)
+
+		// Warehouses, shared by every tenant and edited from the default tenant
+		api.GET("/warehouses", permMiddleware.HasPermission(), warehouseHandler.List)
+		api.GET("/warehouses/:id", permMiddleware.HasPermission(), warehouseHandler.GetByID)
+		api.POST("/warehouses", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), warehouseHandler.Create)
+		api.PUT("/warehouses/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), warehouseHandler.Update)
+		api.DELETE("/warehouses/:id", middlewares.SuperAdminRequired(), permMiddleware.HasPermission(), warehouseHandler.Delete)
+
+		// API keys
+		api.GET("/api-keys", permMiddleware.HasPermission(), apiKeyHandler.List)
+		api.POST("/api-keys", permMiddleware.HasPermission(), apiKeyHandler.Create)
+		api.DELETE("/api-keys/:id", permMiddleware.HasPermission(), apiKeyHandler.Revoke)
+
+		// Role grants
+		api.GET("/role-grants", permMiddleware.HasPermission(), roleGrantHandler.List)
+		api.POST("/role-grants", permMiddleware.HasPermission(), roleGrantHandler.Create)
+		api.POST("/role-grants/:id/approve", permMiddleware.HasPermission(), roleGrantHandler.Approve)
+		api.POST("/role-grants/:id/reject", permMiddleware.HasPermission(), roleGrantHandler.Reject)
+		api.DELETE("/role-grants/:id", permMiddleware.HasPermission(), roleGrantHandler.Revoke)
+
+		// Invitations
+		api.GET("/invitations", permMiddleware.HasPermission(), invitationHandler.List)
+		api.POST("/invitations", permMiddleware.HasPermission(), invitationHandler.Create)
+		api.POST("/invitations/:id/resend", permMiddleware.HasPermission(), invitationHandler.Resend)
+		api.DELETE("/invitations/:id", permMiddleware.HasPermission(), invitationHandler.Revoke)
+
+		// Policy decisions for other services
+		api.POST("/authorize", permMiddleware.HasPermission(), authorizeHandler.Authorize)
 	}
 
 	// Start the server
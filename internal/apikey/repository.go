@@ -0,0 +1,90 @@
+package apikey
+
+import (
+	"errors"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindByID(id uint) (*models.APIKey, error)
+	FindByPrefix(prefix string) (*models.APIKey, error)
+	Create(key *models.APIKey) error
+	List(userID uint) ([]models.APIKey, error)
+	Revoke(id uint, at time.Time) error
+	TouchLastUsed(id uint, at time.Time) error
+
+	// ForTenant returns a repository whose FindByID and List only reach keys
+	// of users of the tenant
+	ForTenant(tenantID uint) Repository
+}
+
+type repository struct {
+	db       *gorm.DB
+	tenantID uint // 0 reaches every tenant
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ForTenant(tenantID uint) Repository {
+	return &repository{db: r.db, tenantID: tenantID}
+}
+
+// query starts an api keys query limited to users of the tenant
+func (r *repository) query() *gorm.DB {
+	if r.tenantID == 0 {
+		return r.db
+	}
+	return r.db.Where("api_keys.user_id IN (SELECT id FROM users WHERE tenant_id = ?)", r.tenantID)
+}
+
+func (r *repository) FindByID(id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.query().First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("api key not found")
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *repository) FindByPrefix(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("api key not found")
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *repository) Create(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// List returns the keys of a user, or every key when userID is 0
+func (r *repository) List(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	query := r.query().Order("id")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *repository) Revoke(id uint, at time.Time) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).Update("revoked_at", at).Error
+}
+
+func (r *repository) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/authz"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/logger"
+)
+
+// Keys look like "ak_<prefix>.<secret>"
+const keyPrefix = "ak_"
+
+// lastUsedResolution limits how often a busy key writes its last-used timestamp
+const lastUsedResolution = time.Minute
+
+// ErrInvalidAPIKey is returned for unknown, malformed, expired or revoked keys
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrInvalidScope is returned for scopes that are not valid endpoint patterns
+var ErrInvalidScope = errors.New("invalid api key scope")
+
+type Usecase struct {
+	repo     Repository
+	userRepo user.Repository
+}
+
+func NewUsecase(repo Repository, userRepo user.Repository) *Usecase {
+	return &Usecase{
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+// ForTenant returns a usecase that only reaches keys and owners of the tenant
+func (u *Usecase) ForTenant(tenantID uint) *Usecase {
+	return &Usecase{
+		repo:     u.repo.ForTenant(tenantID),
+		userRepo: u.userRepo.ForTenant(tenantID),
+	}
+}
+
+// Generate creates a key for the owner and returns it in plain text.
+// The plain key is only available here, it cannot be recovered later. Keys act
+// with the roles of their owner, so users only create keys for themselves.
+func (u *Usecase) Generate(name string, ownerID uint, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	// Scopes are matched like permission endpoints
+	for _, scope := range scopes {
+		if !authz.ValidPattern(scope) {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if _, err := u.userRepo.FindByID(ownerID); err != nil {
+		return "", nil, errors.New("owner not found")
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	secretString := base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &models.APIKey{
+		Name:       name,
+		Prefix:     keyPrefix + prefix,
+		SecretHash: hashSecret(secretString),
+		UserID:     ownerID,
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+		CreatedBy:  ownerID,
+	}
+	if err := u.repo.Create(key); err != nil {
+		return "", nil, err
+	}
+
+	return key.Prefix + "." + secretString, key, nil
+}
+
+// Authenticate validates a plain key and returns it with its owner
+func (u *Usecase) Authenticate(plainKey string) (*models.APIKey, *models.User, error) {
+	prefix, secret, ok := strings.Cut(plainKey, ".")
+	if !ok || !strings.HasPrefix(prefix, keyPrefix) || secret == "" {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := u.repo.FindByPrefix(prefix)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashSecret(secret))) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	owner, err := u.userRepo.FindByID(key.UserID)
+	if err != nil || owner.Blocked(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		if err := u.repo.TouchLastUsed(key.ID, now); err != nil {
+			logger.Logger.Error("Error updating api key last use: " + err.Error())
+		}
+	}
+
+	return key, owner, nil
+}
+
+func (u *Usecase) List(userID uint) ([]models.APIKey, error) {
+	return u.repo.List(userID)
+}
+
+// Revoke revokes a key of the owner; keys of other users are not found
+func (u *Usecase) Revoke(id, ownerID uint) error {
+	key, err := u.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if key.UserID != ownerID {
+		return errors.New("api key not found")
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	return u.repo.Revoke(id, time.Now())
+}
+
+// hashSecret uses SHA-256: secrets are 256 random bits, so a slow hash adds nothing
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/user"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator verifies a login and password against one credential source.
+// The returned error is only logged, clients always get ErrInvalidCredentials.
+type Authenticator interface {
+	Name() string
+	Authenticate(login, password string) (*models.User, error)
+}
+
+// dummyHash is compared against when the user does not exist, so that the
+// response time matches the one of a wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+
+type localAuthenticator struct {
+	userRepo user.Repository
+}
+
+// NewLocalAuthenticator checks the bcrypt password stored in models.User
+func NewLocalAuthenticator(userRepo user.Repository) Authenticator {
+	return &localAuthenticator{userRepo: userRepo}
+}
+
+func (a *localAuthenticator) Name() string {
+	return models.AuthProviderLocal
+}
+
+func (a *localAuthenticator) Authenticate(login, password string) (*models.User, error) {
+	// Check if the email or username exists
+	u, err := findByLogin(a.userRepo, login)
+	if err != nil {
+		// Burn the same bcrypt time as a real comparison
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, errors.New("user not found: " + err.Error())
+	}
+
+	// Users managed by another provider have no usable local password
+	if u.AuthProvider != "" && u.AuthProvider != models.AuthProviderLocal {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, errors.New("user is managed by " + u.AuthProvider)
+	}
+
+	// Verify password
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+		return nil, errors.New("wrong password")
+	}
+
+	return u, nil
+}
+
+// findByLogin treats logins containing "@" as emails and anything else as a username
+func findByLogin(userRepo user.Repository, login string) (*models.User, error) {
+	if strings.Contains(login, "@") {
+		return userRepo.FindByEmail(login)
+	}
+	return userRepo.FindByUsername(login)
+}
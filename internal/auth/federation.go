@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+// ErrFederatedUserNotLinked is returned when an external identity has no local
+// user and auto-provisioning is disabled
+var ErrFederatedUserNotLinked = errors.New("la cuenta externa no está vinculada a ningún usuario")
+
+// ErrFederatedUserPending is returned when the linked user has not accepted
+// their invitation yet
+var ErrFederatedUserPending = errors.New("la cuenta está pendiente de activación")
+
+// federatedProfile is what an external identity provider asserts about a user.
+// Empty fields are left untouched on the local user.
+type federatedProfile struct {
+	Subject        string
+	Email          string
+	Name           string
+	LastName       string
+	CommercialZone string
+	Warehouse      string
+	Province       string
+	RoleName       string
+}
+
+// federatedLinker resolves external identities to local users
+type federatedLinker struct {
+	userRepo     user.Repository
+	roleRepo     role.Repository
+	identityRepo federation.Repository
+}
+
+// link returns the user linked to the provider subject, refreshed with the
+// profile. Unknown subjects get a new user in the profile role (or defaultRole)
+// when autoProvision is set; existing local accounts are never linked
+// implicitly by email. Invited users must accept the invitation first, as
+// with password logins.
+func (l *federatedLinker) link(provider, authProvider string, profile federatedProfile, autoProvision bool, defaultRole string) (*models.User, error) {
+	identity, err := l.identityRepo.FindBySubject(provider, profile.Subject)
+	if err == nil {
+		u, err := l.userRepo.FindByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if u.Status == models.UserStatusPending {
+			return nil, ErrFederatedUserPending
+		}
+		return l.sync(u, profile)
+	}
+
+	if !autoProvision {
+		return nil, ErrFederatedUserNotLinked
+	}
+	if profile.Email == "" {
+		return nil, errors.New("the identity provider did not return an email")
+	}
+	if _, err := l.userRepo.FindByEmail(profile.Email); err == nil {
+		return nil, fmt.Errorf("a user with email %s already exists and is not linked", profile.Email)
+	}
+
+	roleName := profile.RoleName
+	if roleName == "" {
+		roleName = defaultRole
+	}
+	// Federated users are provisioned in the default tenant
+	role, err := l.roleRepo.ForTenant(models.DefaultTenantID).FindByName(roleName)
+	if err != nil {
+		return nil, fmt.Errorf("role %s: %w", roleName, err)
+	}
+
+	u := &models.User{
+		Email: profile.Email,
+		// Federated users never log in with a local password
+		Password:       "!",
+		Name:           profile.Name,
+		LastName:       profile.LastName,
+		CommercialZone: profile.CommercialZone,
+		Warehouse:      profile.Warehouse,
+		Province:       profile.Province,
+		RoleID:         role.ID,
+		TenantID:       models.DefaultTenantID,
+		AuthProvider:   authProvider,
+	}
+	if err := l.userRepo.Create(u); err != nil {
+		return nil, err
+	}
+
+	if err := l.identityRepo.Create(&models.FederatedIdentity{
+		UserID:   u.ID,
+		Provider: provider,
+		Subject:  profile.Subject,
+		Email:    profile.Email,
+	}); err != nil {
+		return nil, err
+	}
+
+	return l.userRepo.FindByID(u.ID)
+}
+
+// sync copies the non-empty profile fields to an already linked user
+func (l *federatedLinker) sync(u *models.User, profile federatedProfile) (*models.User, error) {
+	changed := false
+	for _, field := range []struct {
+		target *string
+		value  string
+	}{
+		{&u.Name, profile.Name},
+		{&u.LastName, profile.LastName},
+		{&u.CommercialZone, profile.CommercialZone},
+		{&u.Warehouse, profile.Warehouse},
+		{&u.Province, profile.Province},
+	} {
+		if field.value != "" && *field.target != field.value {
+			*field.target = field.value
+			changed = true
+		}
+	}
+
+	if profile.RoleName != "" && profile.RoleName != u.Role.Name {
+		role, err := l.roleRepo.ForTenant(u.TenantID).FindByName(profile.RoleName)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", profile.RoleName, err)
+		}
+		u.RoleID = role.ID
+		u.Role = *role
+		u.Roles = []models.Role{*role}
+		changed = true
+	}
+
+	if !changed {
+		return u, nil
+	}
+	if err := l.userRepo.Update(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
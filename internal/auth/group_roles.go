@@ -0,0 +1,38 @@
+package auth
+
+import "strings"
+
+// GroupRole maps a group of an external directory or identity provider to a local role name
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// ParseGroupRoles parses mappings in the form "group=>ROLE;group=>ROLE".
+// Groups may be DNs, so "," and "=" cannot be used as separators.
+func ParseGroupRoles(value string) []GroupRole {
+	var mappings []GroupRole
+	for _, item := range strings.Split(value, ";") {
+		parts := strings.SplitN(item, "=>", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		group, roleName := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if group != "" && roleName != "" {
+			mappings = append(mappings, GroupRole{Group: group, Role: roleName})
+		}
+	}
+	return mappings
+}
+
+// mapGroupsToRole returns the role of the first mapping the groups match, or "" if none does
+func mapGroupsToRole(mappings []GroupRole, groups []string) string {
+	for _, mapping := range mappings {
+		for _, group := range groups {
+			if strings.EqualFold(mapping.Group, group) {
+				return mapping.Role
+			}
+		}
+	}
+	return ""
+}
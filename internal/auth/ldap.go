@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/logger"
+)
+
+// LDAPConfig configures authentication against LDAP / Active Directory
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string // Service account used to search users
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // Search filter, every %s is replaced by the escaped login (ej: "(sAMAccountName=%s)")
+	EmailAttribute     string
+	UsernameAttribute  string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	GroupAttribute     string
+	GroupRoles         []GroupRole // First matching group wins
+	DefaultRole        string      // Role for users without a mapped group; empty rejects them
+}
+
+// LDAPConn is the part of an LDAP connection used by the authenticator
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+type ldapAuthenticator struct {
+	config       LDAPConfig
+	userRepo     user.Repository
+	roleRepo     role.Repository
+	identityRepo federation.Repository
+	dial         func(config LDAPConfig) (LDAPConn, error)
+}
+
+// NewLDAPAuthenticator binds against the directory and provisions or updates
+// the local user row on every successful login. Local users are only taken
+// over by the directory when an admin linked their entry DN beforehand.
+func NewLDAPAuthenticator(config LDAPConfig, userRepo user.Repository, roleRepo role.Repository, identityRepo federation.Repository) Authenticator {
+	return &ldapAuthenticator{
+		config:       config,
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		identityRepo: identityRepo,
+		dial:         dialLDAP,
+	}
+}
+
+func dialLDAP(config LDAPConfig) (LDAPConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (a *ldapAuthenticator) Name() string {
+	return models.AuthProviderLDAP
+}
+
+func (a *ldapAuthenticator) Authenticate(login, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which always succeeds
+	if password == "" {
+		return nil, errors.New("empty password")
+	}
+
+	conn, err := a.dial(a.config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to directory: %w", err)
+	}
+	defer conn.Close()
+
+	entry, err := a.findEntry(conn, login)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify password by binding as the user
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, errors.New("wrong password")
+	}
+
+	roleName := a.mapRole(entry.GetAttributeValues(a.config.GroupAttribute))
+	if roleName == "" {
+		return nil, errors.New("no role mapped for the user's groups")
+	}
+
+	return a.provision(entry, roleName)
+}
+
+func (a *ldapAuthenticator) findEntry(conn LDAPConn, login string) (*ldap.Entry, error) {
+	if a.config.BindDN != "" {
+		if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		strings.ReplaceAll(a.config.UserFilter, "%s", ldap.EscapeFilter(login)),
+		[]string{
+			a.config.EmailAttribute,
+			a.config.UsernameAttribute,
+			a.config.FirstNameAttribute,
+			a.config.LastNameAttribute,
+			a.config.GroupAttribute,
+		},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("searching user: %w", err)
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("expected one directory entry, found %d", len(result.Entries))
+	}
+
+	return result.Entries[0], nil
+}
+
+// mapRole returns the role of the first configured group the user belongs to
+func (a *ldapAuthenticator) mapRole(groups []string) string {
+	if roleName := mapGroupsToRole(a.config.GroupRoles, groups); roleName != "" {
+		return roleName
+	}
+	return a.config.DefaultRole
+}
+
+// provision creates the local user row on first login, or refreshes it from the directory
+func (a *ldapAuthenticator) provision(entry *ldap.Entry, roleName string) (*models.User, error) {
+	email := entry.GetAttributeValue(a.config.EmailAttribute)
+	if email == "" {
+		return nil, errors.New("directory entry has no email")
+	}
+
+	u, err := a.userRepo.FindByEmail(email)
+	if err != nil {
+		// Directory users are provisioned in the default tenant
+		u = &models.User{
+			Email:    email,
+			TenantID: models.DefaultTenantID,
+			// Directory users never log in with a local password
+			Password: "!",
+		}
+	} else if u.AuthProvider != models.AuthProviderLDAP {
+		// Same email is not enough: the directory would take over the account and its roles
+		identity, err := a.identityRepo.FindBySubject(models.AuthProviderLDAP, entry.DN)
+		if err != nil || identity.UserID != u.ID {
+			return nil, fmt.Errorf("a user with email %s already exists and is not linked to the directory", email)
+		}
+		logger.Logger.Info("Linking local user " + email + " to LDAP")
+	}
+
+	role, err := a.roleRepo.ForTenant(u.TenantID).FindByName(roleName)
+	if err != nil {
+		return nil, fmt.Errorf("mapped role %s: %w", roleName, err)
+	}
+
+	u.AuthProvider = models.AuthProviderLDAP
+	u.Name = entry.GetAttributeValue(a.config.FirstNameAttribute)
+	u.LastName = entry.GetAttributeValue(a.config.LastNameAttribute)
+	// The directory groups decide the roles of the user
+	u.RoleID = role.ID
+	u.Role = *role
+	u.Roles = []models.Role{*role}
+
+	if userName := user.NormalizeUsername(entry.GetAttributeValue(a.config.UsernameAttribute)); userName != "" {
+		if exists, err := a.userRepo.UsernameExists(userName, u.ID); err == nil && !exists {
+			u.UserName = &userName
+		}
+	}
+
+	if u.ID == 0 {
+		err = a.userRepo.Create(u)
+	} else {
+		err = a.userRepo.Update(u)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("provisioning user: %w", err)
+	}
+
+	return u, nil
+}
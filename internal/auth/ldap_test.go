@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+const (
+	serviceDN       = "cn=svc,dc=example,dc=com"
+	servicePassword = "svc-secret"
+	aliceDN         = "uid=alice,ou=people,dc=example,dc=com"
+	alicePassword   = "alice-secret"
+)
+
+// fakeDirectory is an in-process LDAP stand-in holding entries and their passwords
+type fakeDirectory struct {
+	passwords map[string]string
+	entries   []*ldap.Entry
+	closed    bool
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if expected, ok := d.passwords[username]; ok && expected == password {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+// Search returns the entries whose uid appears in the filter; the tests only
+// use "(uid=%s)" filters
+func (d *fakeDirectory) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		if searchRequest.Filter == "(uid="+ldap.EscapeFilter(entry.GetAttributeValue("uid"))+")" {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	d.closed = true
+	return nil
+}
+
+// fakeUsers keeps users in memory; methods the authenticator does not use panic
+type fakeUsers struct {
+	user.Repository
+	byEmail map[string]*models.User
+	nextID  uint
+}
+
+func (r *fakeUsers) FindByEmail(email string) (*models.User, error) {
+	if u, ok := r.byEmail[email]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUsers) UsernameExists(username string, excludeID uint) (bool, error) {
+	for _, u := range r.byEmail {
+		if u.UserName != nil && *u.UserName == username && u.ID != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeUsers) Create(u *models.User) error {
+	r.nextID++
+	u.ID = r.nextID
+	r.byEmail[u.Email] = u
+	return nil
+}
+
+func (r *fakeUsers) Update(u *models.User) error {
+	r.byEmail[u.Email] = u
+	return nil
+}
+
+type fakeRoles struct {
+	role.Repository
+	roles []models.Role
+}
+
+func (r *fakeRoles) ForTenant(tenantID uint) role.Repository {
+	return r
+}
+
+func (r *fakeRoles) FindByName(name string) (*models.Role, error) {
+	for i := range r.roles {
+		if r.roles[i].Name == name {
+			return &r.roles[i], nil
+		}
+	}
+	return nil, errors.New("role not found")
+}
+
+type fakeIdentities struct {
+	federation.Repository
+	identities []models.FederatedIdentity
+}
+
+func (r *fakeIdentities) FindBySubject(provider, subject string) (*models.FederatedIdentity, error) {
+	for i := range r.identities {
+		if r.identities[i].Provider == provider && r.identities[i].Subject == subject {
+			return &r.identities[i], nil
+		}
+	}
+	return nil, errors.New("identity not found")
+}
+
+type ldapFixture struct {
+	directory  *fakeDirectory
+	users      *fakeUsers
+	identities *fakeIdentities
+	auth       *ldapAuthenticator
+}
+
+func newLDAPFixture(groups ...string) *ldapFixture {
+	f := &ldapFixture{
+		directory: &fakeDirectory{
+			passwords: map[string]string{serviceDN: servicePassword, aliceDN: alicePassword},
+			entries: []*ldap.Entry{ldap.NewEntry(aliceDN, map[string][]string{
+				"uid":       {"alice"},
+				"mail":      {"alice@example.com"},
+				"givenName": {"Alice"},
+				"sn":        {"Smith"},
+				"memberOf":  groups,
+			})},
+		},
+		users:      &fakeUsers{byEmail: map[string]*models.User{}},
+		identities: &fakeIdentities{},
+	}
+	roles := &fakeRoles{roles: []models.Role{{ID: 1, Name: "ADMIN"}, {ID: 2, Name: "SELLER"}, {ID: 3, Name: "VIEWER"}}}
+
+	f.auth = NewLDAPAuthenticator(LDAPConfig{
+		BindDN:             serviceDN,
+		BindPassword:       servicePassword,
+		BaseDN:             "dc=example,dc=com",
+		UserFilter:         "(uid=%s)",
+		EmailAttribute:     "mail",
+		UsernameAttribute:  "uid",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		GroupAttribute:     "memberOf",
+		GroupRoles:         ParseGroupRoles("cn=admins,dc=example,dc=com=>ADMIN;cn=sales,dc=example,dc=com=>SELLER"),
+		DefaultRole:        "VIEWER",
+	}, f.users, roles, f.identities).(*ldapAuthenticator)
+	f.auth.dial = func(config LDAPConfig) (LDAPConn, error) {
+		return f.directory, nil
+	}
+	return f
+}
+
+func TestLDAPAuthenticateRejectsWrongPassword(t *testing.T) {
+	f := newLDAPFixture()
+
+	if _, err := f.auth.Authenticate("alice", "wrong"); err == nil {
+		t.Fatal("expected the bind with a wrong password to fail")
+	}
+	if len(f.users.byEmail) != 0 {
+		t.Fatal("a failed bind must not provision the user")
+	}
+	if !f.directory.closed {
+		t.Fatal("the connection was not closed")
+	}
+}
+
+func TestLDAPAuthenticateRejectsEmptyPassword(t *testing.T) {
+	f := newLDAPFixture()
+	// Empty passwords would be unauthenticated binds, which directories accept
+	f.directory.passwords[aliceDN] = ""
+
+	if _, err := f.auth.Authenticate("alice", ""); err == nil {
+		t.Fatal("expected an empty password to be refused")
+	}
+}
+
+func TestLDAPAuthenticateRejectsServiceBindFailure(t *testing.T) {
+	f := newLDAPFixture()
+	f.directory.passwords[serviceDN] = "rotated"
+
+	if _, err := f.auth.Authenticate("alice", alicePassword); err == nil {
+		t.Fatal("expected the service account bind failure to be reported")
+	}
+}
+
+func TestLDAPAuthenticateUnknownUser(t *testing.T) {
+	f := newLDAPFixture()
+
+	if _, err := f.auth.Authenticate("bob", alicePassword); err == nil {
+		t.Fatal("expected a login without directory entry to fail")
+	}
+}
+
+func TestLDAPGroupRoleMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		role   string
+	}{
+		{"first configured group wins", []string{"cn=sales,dc=example,dc=com", "cn=admins,dc=example,dc=com"}, "ADMIN"},
+		{"groups match case-insensitively", []string{"CN=Sales,DC=example,DC=com"}, "SELLER"},
+		{"unmapped groups get the default role", []string{"cn=other,dc=example,dc=com"}, "VIEWER"},
+		{"no groups get the default role", nil, "VIEWER"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newLDAPFixture(tt.groups...)
+
+			u, err := f.auth.Authenticate("alice", alicePassword)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if u.Role.Name != tt.role || len(u.Roles) != 1 || u.Roles[0].Name != tt.role {
+				t.Fatalf("got role %q (roles %v), want %q", u.Role.Name, u.Roles, tt.role)
+			}
+		})
+	}
+}
+
+func TestLDAPRejectsUnmappedUserWithoutDefaultRole(t *testing.T) {
+	f := newLDAPFixture("cn=other,dc=example,dc=com")
+	f.auth.config.DefaultRole = ""
+
+	if _, err := f.auth.Authenticate("alice", alicePassword); err == nil {
+		t.Fatal("expected users without mapped group to be refused")
+	}
+}
+
+func TestLDAPProvisionsNewUser(t *testing.T) {
+	f := newLDAPFixture("cn=sales,dc=example,dc=com")
+
+	u, err := f.auth.Authenticate("alice", alicePassword)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	stored, ok := f.users.byEmail["alice@example.com"]
+	if !ok || stored.ID == 0 || stored.ID != u.ID {
+		t.Fatal("the user was not created")
+	}
+	if u.AuthProvider != models.AuthProviderLDAP || u.Password != "!" {
+		t.Fatalf("got provider %q and password %q, want an LDAP user without local password", u.AuthProvider, u.Password)
+	}
+	if u.TenantID != models.DefaultTenantID {
+		t.Fatalf("got tenant %d, want the default tenant", u.TenantID)
+	}
+	if u.Name != "Alice" || u.LastName != "Smith" || u.UserName == nil || *u.UserName != "alice" {
+		t.Fatalf("profile not copied from the directory: %+v", u)
+	}
+}
+
+func TestLDAPRefreshesProvisionedUser(t *testing.T) {
+	f := newLDAPFixture("cn=admins,dc=example,dc=com")
+	f.users.Create(&models.User{
+		Email:        "alice@example.com",
+		Name:         "Old",
+		RoleID:       3,
+		AuthProvider: models.AuthProviderLDAP,
+		TenantID:     models.DefaultTenantID,
+	})
+
+	u, err := f.auth.Authenticate("alice", alicePassword)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if u.ID != 1 || len(f.users.byEmail) != 1 {
+		t.Fatal("expected the existing user to be updated, not duplicated")
+	}
+	if u.Name != "Alice" || u.RoleID != 1 {
+		t.Fatalf("got name %q and role %d, want the directory values", u.Name, u.RoleID)
+	}
+}
+
+func TestLDAPDoesNotTakeOverUnlinkedLocalUser(t *testing.T) {
+	f := newLDAPFixture("cn=admins,dc=example,dc=com")
+	f.users.Create(&models.User{Email: "alice@example.com", Password: "hash", RoleID: 3, AuthProvider: models.AuthProviderLocal})
+
+	if _, err := f.auth.Authenticate("alice", alicePassword); err == nil {
+		t.Fatal("expected a local user with the same email to be refused")
+	}
+	local := f.users.byEmail["alice@example.com"]
+	if local.AuthProvider != models.AuthProviderLocal || local.RoleID != 3 {
+		t.Fatal("the local user was changed")
+	}
+}
+
+func TestLDAPLinksLocalUserWithExplicitLink(t *testing.T) {
+	f := newLDAPFixture("cn=sales,dc=example,dc=com")
+	f.users.Create(&models.User{Email: "alice@example.com", Password: "hash", RoleID: 3, AuthProvider: models.AuthProviderLocal})
+	f.identities.identities = append(f.identities.identities, models.FederatedIdentity{
+		UserID:   1,
+		Provider: models.AuthProviderLDAP,
+		Subject:  aliceDN,
+	})
+
+	u, err := f.auth.Authenticate("alice", alicePassword)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if u.ID != 1 || u.AuthProvider != models.AuthProviderLDAP || u.RoleID != 2 {
+		t.Fatalf("got user %d with provider %q and role %d, want the linked user moved to LDAP", u.ID, u.AuthProvider, u.RoleID)
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/logger"
+	"github.com/j94veron/auth-service-insu/pkg/mailer"
+	"github.com/j94veron/auth-service-insu/pkg/token"
+	"go.uber.org/zap"
+)
+
+const (
+	magicLinkPurpose   = "magic_link"
+	magicLinkKeyPrefix = "magic_link:"
+)
+
+// ErrMagicLinkDisabled is returned when no role is allowed to use magic links
+var ErrMagicLinkDisabled = errors.New("magic link login is disabled")
+
+// ErrInvalidMagicLink is returned for expired, reused or tampered links
+var ErrInvalidMagicLink = errors.New("enlace inválido o expirado")
+
+// MagicLinkConfig configures passwordless login by email
+type MagicLinkConfig struct {
+	AllowedRoles []string      // Role names allowed to log in by magic link
+	TTL          time.Duration // Lifetime of a link
+	LinkURL      string        // Frontend URL the token is appended to (ej: "https://app/login/magic?token=")
+}
+
+type MagicLinkService struct {
+	authService *Service
+	mailer      mailer.Mailer
+	config      MagicLinkConfig
+}
+
+func NewMagicLinkService(authService *Service, mailer mailer.Mailer, config MagicLinkConfig) *MagicLinkService {
+	return &MagicLinkService{
+		authService: authService,
+		mailer:      mailer,
+		config:      config,
+	}
+}
+
+// Request sends a magic link to the email if it belongs to a user with an allowed role.
+// Unknown or not allowed addresses are only logged, so the caller always gets the same answer.
+func (m *MagicLinkService) Request(email string) error {
+	if len(m.config.AllowedRoles) == 0 {
+		return ErrMagicLinkDisabled
+	}
+
+	user, err := m.authService.userRepo.FindByEmail(email)
+	if err != nil {
+		logMagicLinkFailure(email, "user not found: "+err.Error())
+		return nil
+	}
+	if !m.roleAllowed(user) {
+		logMagicLinkFailure(email, "role not allowed: "+user.Role.Name)
+		return nil
+	}
+	if user.Status == models.UserStatusPending {
+		logMagicLinkFailure(email, "account pending activation")
+		return nil
+	}
+
+	// Send in the background so the response time does not reveal the address exists
+	go m.send(user)
+
+	return nil
+}
+
+func (m *MagicLinkService) send(user *models.User) {
+	link, id, err := m.authService.tokenService.CreateActionToken(magicLinkPurpose, user.ID, m.config.TTL)
+	if err != nil {
+		logger.Logger.Error("Error creating magic link: " + err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	if err := m.authService.redisClient.SaveValue(ctx, magicLinkKeyPrefix+id, user.ID, m.config.TTL); err != nil {
+		logger.Logger.Error("Error saving magic link: " + err.Error())
+		return
+	}
+
+	body := "Hola " + user.Name + ",\n\n" +
+		"Usá el siguiente enlace para ingresar. Vence en " + strconv.Itoa(int(m.config.TTL.Minutes())) + " minutos y solo puede usarse una vez:\n\n" +
+		m.config.LinkURL + link + "\n\n" +
+		"Si no lo solicitaste, ignorá este correo.\n"
+
+	if err := m.mailer.Send(user.Email, "Tu enlace de acceso", body); err != nil {
+		logger.Logger.Error("Error sending magic link: " + err.Error())
+	}
+}
+
+// Redeem exchanges a magic link token for a regular token pair. Each link can be used once.
+func (m *MagicLinkService) Redeem(tokenString string) (*models.TokenDetail, *models.User, error) {
+	if len(m.config.AllowedRoles) == 0 {
+		return nil, nil, ErrMagicLinkDisabled
+	}
+
+	claims, err := m.authService.tokenService.VerifyActionToken(tokenString, magicLinkPurpose)
+	if err != nil {
+		return nil, nil, ErrInvalidMagicLink
+	}
+
+	// Consuming the key makes the link single-use
+	ctx := context.Background()
+	stored, err := m.authService.redisClient.ConsumeValue(ctx, magicLinkKeyPrefix+claims.Id)
+	if err != nil || stored != strconv.FormatUint(uint64(claims.UserID), 10) {
+		return nil, nil, ErrInvalidMagicLink
+	}
+
+	user, err := m.authService.userRepo.FindByID(claims.UserID)
+	if err != nil || !m.roleAllowed(user) {
+		return nil, nil, ErrInvalidMagicLink
+	}
+
+	td, err := m.authService.issueTokens(user, token.AmrEmail)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return td, user, nil
+}
+
+func (m *MagicLinkService) roleAllowed(user *models.User) bool {
+	for _, role := range m.config.AllowedRoles {
+		if role == user.Role.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func logMagicLinkFailure(email, reason string) {
+	logger.Logger.Warn("Magic link not sent",
+		zap.String("event", "magic_link_rejected"),
+		zap.String("login", email),
+		zap.String("reason", reason),
+	)
+}
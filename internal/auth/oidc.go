@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/logger"
+	"github.com/j94veron/auth-service-insu/pkg/token"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateKeyPrefix = "oidc_state:"
+	oidcStateTTL       = 10 * time.Minute
+)
+
+// ErrUnknownOIDCProvider is returned for provider names that are not configured
+var ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+
+// ErrInvalidOIDCCallback is returned when the callback state, code or ID token is not valid
+var ErrInvalidOIDCCallback = errors.New("login federado inválido o expirado")
+
+// OIDCProviderConfig configures one external OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	Name          string // Used in the login and callback URLs
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string // Must point to /api/oidc/{name}/callback
+	Scopes        []string
+	AutoProvision bool   // Create a user on first login instead of rejecting unlinked identities
+	DefaultRole   string // Role given to auto-provisioned users
+}
+
+type oidcProvider struct {
+	config   OIDCProviderConfig
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcState is kept in Redis between the redirect to the provider and the callback
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type OIDCService struct {
+	authService *Service
+	linker      *federatedLinker
+	providers   map[string]*oidcProvider
+}
+
+func NewOIDCService(authService *Service, roleRepo role.Repository, identityRepo federation.Repository, providers []OIDCProviderConfig) *OIDCService {
+	s := &OIDCService{
+		authService: authService,
+		linker: &federatedLinker{
+			userRepo:     authService.userRepo,
+			roleRepo:     roleRepo,
+			identityRepo: identityRepo,
+		},
+		providers: make(map[string]*oidcProvider),
+	}
+	for _, config := range providers {
+		s.providers[config.Name] = &oidcProvider{config: config}
+	}
+	return s
+}
+
+// AuthCodeURL starts a login with the provider and returns the URL to redirect the user to
+func (s *OIDCService) AuthCodeURL(providerName string) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+
+	ctx := context.Background()
+	oauth2Config, _, err := provider.load(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	stateValue, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	state := oidcState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	if err := s.authService.redisClient.SaveValue(ctx, oidcStateKeyPrefix+stateValue, data, oidcStateTTL); err != nil {
+		return "", err
+	}
+
+	return oauth2Config.AuthCodeURL(stateValue,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(state.CodeVerifier),
+	), nil
+}
+
+// Callback validates the provider response, links the identity to a user and issues our tokens
+func (s *OIDCService) Callback(providerName, stateValue, code string) (*models.TokenDetail, *models.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrUnknownOIDCProvider
+	}
+
+	// Each state can only be used once
+	ctx := context.Background()
+	data, err := s.authService.redisClient.ConsumeValue(ctx, oidcStateKeyPrefix+stateValue)
+	if err != nil {
+		logOIDCFailure(providerName, "unknown or expired state")
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+	var state oidcState
+	if err := json.Unmarshal([]byte(data), &state); err != nil || state.Provider != providerName {
+		logOIDCFailure(providerName, "state issued for another provider")
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+
+	oauth2Config, verifier, err := provider.load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oauth2Token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(state.CodeVerifier))
+	if err != nil {
+		logOIDCFailure(providerName, "code exchange: "+err.Error())
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		logOIDCFailure(providerName, "no id_token in token response")
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		logOIDCFailure(providerName, "id_token verification: "+err.Error())
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+	if idToken.Nonce != state.Nonce {
+		logOIDCFailure(providerName, "nonce mismatch")
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, err
+	}
+
+	profile := federatedProfile{
+		Subject:  idToken.Subject,
+		Name:     claims.GivenName,
+		LastName: claims.FamilyName,
+	}
+	// Unverified emails are not trusted for new accounts
+	if claims.EmailVerified {
+		profile.Email = claims.Email
+	}
+
+	user, err := s.linker.link(providerName, models.AuthProviderOIDC, profile, provider.config.AutoProvision, provider.config.DefaultRole)
+	if err != nil {
+		logOIDCFailure(providerName, "linking subject "+idToken.Subject+": "+err.Error())
+		if errors.Is(err, ErrFederatedUserNotLinked) {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidOIDCCallback
+	}
+
+	td, err := s.authService.issueTokens(user, token.AmrFederated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return td, user, nil
+}
+
+// load discovers the provider configuration on first use, so that an
+// unreachable provider does not prevent the service from starting
+func (p *oidcProvider) load(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discovering provider %s: %w", p.config.Name, err)
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, p.config.Scopes...),
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+
+	return p.oauth2, p.verifier, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func logOIDCFailure(provider, reason string) {
+	logger.Logger.Warn("Federated login failed",
+		zap.String("event", "oidc_login_failed"),
+		zap.String("provider", provider),
+		zap.String("reason", reason),
+	)
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/logger"
+	"github.com/j94veron/auth-service-insu/pkg/token"
+	dsig "github.com/russellhaering/goxmldsig"
+	"go.uber.org/zap"
+)
+
+const (
+	samlRelayKeyPrefix = "saml_relay:"
+	samlRequestTTL     = 10 * time.Minute
+)
+
+// ErrInvalidSAMLResponse is returned when the assertion posted to the ACS is not valid
+var ErrInvalidSAMLResponse = errors.New("respuesta SAML inválida o expirada")
+
+// SAMLAttributes names the assertion attributes mapped to user fields
+type SAMLAttributes struct {
+	Email          string
+	Name           string
+	LastName       string
+	CommercialZone string
+	Warehouse      string
+	Province       string
+	Groups         string
+}
+
+// SAMLConfig configures the service as a SAML 2.0 service provider
+type SAMLConfig struct {
+	ProviderName   string // Used to link identities (ej: "saml")
+	EntityID       string
+	RootURL        string // Public base URL of this service (ej: "https://auth.example.com")
+	CertFile       string // SP certificate and key used to sign AuthnRequests
+	KeyFile        string
+	IDPMetadataURL string
+	Attributes     SAMLAttributes
+	GroupRoles     []GroupRole // First matching group wins
+	DefaultRole    string
+	AutoProvision  bool
+}
+
+type SAMLService struct {
+	authService *Service
+	linker      *federatedLinker
+	config      SAMLConfig
+	sp          *saml.ServiceProvider
+
+	// IdP metadata is fetched on first use
+	mu          sync.Mutex
+	idpMetadata *saml.EntityDescriptor
+}
+
+func NewSAMLService(authService *Service, roleRepo role.Repository, identityRepo federation.Repository, config SAMLConfig) (*SAMLService, error) {
+	keyPair, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading SAML key pair: %w", err)
+	}
+	if keyPair.Leaf == nil {
+		return nil, errors.New("SAML certificate could not be parsed")
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SAML key must be an RSA private key")
+	}
+
+	rootURL, err := url.Parse(config.RootURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SAML root URL: %w", err)
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:    config.EntityID,
+		Key:         key,
+		Certificate: keyPair.Leaf,
+		MetadataURL: *rootURL.ResolveReference(&url.URL{Path: "/api/saml/metadata"}),
+		AcsURL:      *rootURL.ResolveReference(&url.URL{Path: "/api/saml/acs"}),
+		// Sign every AuthnRequest
+		SignatureMethod: dsig.RSASHA256SignatureMethod,
+	}
+
+	return &SAMLService{
+		authService: authService,
+		linker: &federatedLinker{
+			userRepo:     authService.userRepo,
+			roleRepo:     roleRepo,
+			identityRepo: identityRepo,
+		},
+		config: config,
+		sp:     sp,
+	}, nil
+}
+
+// Metadata returns the SP metadata document to register at the IdP
+func (s *SAMLService) Metadata() ([]byte, error) {
+	return xml.MarshalIndent(s.sp.Metadata(), "", "  ")
+}
+
+// AuthnRequestURL builds a signed AuthnRequest and returns the IdP URL to redirect the user to
+func (s *SAMLService) AuthnRequestURL() (string, error) {
+	ctx := context.Background()
+	sp, err := s.serviceProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+
+	// The relay state ties the ACS response to this request
+	relayState, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	if err := s.authService.redisClient.SaveValue(ctx, samlRelayKeyPrefix+relayState, req.ID, samlRequestTTL); err != nil {
+		return "", err
+	}
+
+	redirectURL, err := req.Redirect(relayState, sp)
+	if err != nil {
+		return "", err
+	}
+	return redirectURL.String(), nil
+}
+
+// ACS validates the assertion posted by the IdP and issues our tokens
+func (s *SAMLService) ACS(r *http.Request) (*models.TokenDetail, *models.User, error) {
+	ctx := context.Background()
+	sp, err := s.serviceProvider(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, ErrInvalidSAMLResponse
+	}
+
+	// Only responses to our own requests are accepted, each of them once
+	requestID, err := s.authService.redisClient.ConsumeValue(ctx, samlRelayKeyPrefix+r.PostForm.Get("RelayState"))
+	if err != nil {
+		logSAMLFailure("unknown or expired relay state")
+		return nil, nil, ErrInvalidSAMLResponse
+	}
+
+	assertion, err := sp.ParseResponse(r, []string{requestID})
+	if err != nil {
+		reason := err.Error()
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			reason = invalid.PrivateErr.Error()
+		}
+		logSAMLFailure("assertion validation: " + reason)
+		return nil, nil, ErrInvalidSAMLResponse
+	}
+
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		logSAMLFailure("assertion without subject")
+		return nil, nil, ErrInvalidSAMLResponse
+	}
+
+	attrs := s.config.Attributes
+	profile := federatedProfile{
+		Subject:        assertion.Subject.NameID.Value,
+		Email:          samlAttribute(assertion, attrs.Email),
+		Name:           samlAttribute(assertion, attrs.Name),
+		LastName:       samlAttribute(assertion, attrs.LastName),
+		CommercialZone: samlAttribute(assertion, attrs.CommercialZone),
+		Warehouse:      samlAttribute(assertion, attrs.Warehouse),
+		Province:       samlAttribute(assertion, attrs.Province),
+		RoleName:       mapGroupsToRole(s.config.GroupRoles, samlAttributeValues(assertion, attrs.Groups)),
+	}
+
+	user, err := s.linker.link(s.config.ProviderName, models.AuthProviderSAML, profile, s.config.AutoProvision, s.config.DefaultRole)
+	if err != nil {
+		logSAMLFailure("linking subject " + profile.Subject + ": " + err.Error())
+		if errors.Is(err, ErrFederatedUserNotLinked) {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidSAMLResponse
+	}
+
+	td, err := s.authService.issueTokens(user, token.AmrFederated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return td, user, nil
+}
+
+// serviceProvider returns the SP once the IdP metadata has been loaded
+func (s *SAMLService) serviceProvider(ctx context.Context) (*saml.ServiceProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.idpMetadata == nil {
+		metadataURL, err := url.Parse(s.config.IDPMetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing IdP metadata URL: %w", err)
+		}
+		metadata, err := samlsp.FetchMetadata(ctx, http.DefaultClient, *metadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetching IdP metadata: %w", err)
+		}
+		s.idpMetadata = metadata
+		s.sp.IDPMetadata = metadata
+	}
+
+	return s.sp, nil
+}
+
+// samlAttribute returns the first value of the attribute, matched by name or friendly name
+func samlAttribute(assertion *saml.Assertion, name string) string {
+	if values := samlAttributeValues(assertion, name); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, value := range attr.Values {
+				values = append(values, value.Value)
+			}
+		}
+	}
+	return values
+}
+
+func logSAMLFailure(reason string) {
+	logger.Logger.Warn("SAML login failed",
+		zap.String("event", "saml_login_failed"),
+		zap.String("reason", reason),
+	)
+}
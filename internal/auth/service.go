@@ -5,57 +5,254 @@ import (
 	"errors"
 	"time"
 
+	"github.com/j94veron/auth-service-insu/internal/device"
 	"github.com/j94veron/auth-service-insu/internal/models"
 	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/logger"
 	"github.com/j94veron/auth-service-insu/pkg/redis"
 	"github.com/j94veron/auth-service-insu/pkg/token"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials is returned for every credential failure so callers
+// cannot tell an unknown email from a wrong password
+var ErrInvalidCredentials = errors.New("credenciales inválidas")
+
+// ErrCodeInvalidCredentials is the error code sent to clients with ErrInvalidCredentials
+const ErrCodeInvalidCredentials = "INVALID_CREDENTIALS"
+
+// ErrPasswordReused is returned when the new password equals the current one
+var ErrPasswordReused = errors.New("la nueva contraseña debe ser distinta de la actual")
+
+// ErrPasswordManagedExternally is returned for users authenticated by LDAP or a federated provider
+var ErrPasswordManagedExternally = errors.New("la contraseña de este usuario se administra externamente")
+
+// ErrAccountBlocked is returned when the account is suspended, locked or disabled
+var ErrAccountBlocked = errors.New("la cuenta está suspendida")
+
+// ErrCodeAccountBlocked is the error code sent to clients with ErrAccountBlocked
+const ErrCodeAccountBlocked = "ACCOUNT_BLOCKED"
+
+// ErrWarehouseNotAssigned is returned when a user picks a warehouse they are not assigned to
+var ErrWarehouseNotAssigned = errors.New("el depósito no está asignado al usuario")
+
 type Service struct {
-	userRepo     user.Repository
-	tokenService *token.TokenService
-	redisClient  *redis.Client
+	userRepo       user.Repository
+	tokenService   *token.TokenService
+	redisClient    *redis.Client
+	authenticators []Authenticator
+	loginMonitor   *device.Usecase
 }
 
-func NewService(userRepo user.Repository, tokenService *token.TokenService, redisClient *redis.Client) *Service {
+// NewService creates the auth service. Logins are checked against the
+// authenticators in order; without any, only local passwords are accepted.
+// A nil loginMonitor disables device tracking and step-up MFA.
+func NewService(userRepo user.Repository, tokenService *token.TokenService, redisClient *redis.Client, loginMonitor *device.Usecase, authenticators ...Authenticator) *Service {
+	if len(authenticators) == 0 {
+		authenticators = []Authenticator{NewLocalAuthenticator(userRepo)}
+	}
 	return &Service{
-		userRepo:     userRepo,
-		tokenService: tokenService,
-		redisClient:  redisClient,
+		userRepo:       userRepo,
+		tokenService:   tokenService,
+		redisClient:    redisClient,
+		authenticators: authenticators,
+		loginMonitor:   loginMonitor,
 	}
 }
 
-func (s *Service) Login(email, password, endpoint string) (*models.TokenDetail, *models.User, error) {
-	// Check if the email exists
-	user, err := s.userRepo.FindByEmail(email)
+// Login authenticates a user by email or username with the first
+// authenticator of the chain that accepts the credentials. Suspicious logins
+// may be held with a *StepUpRequiredError until VerifyStepUp is called. The
+// device and location only become known once the login completes, so an
+// abandoned challenge does not make the next attempt look familiar.
+func (s *Service) Login(login, password, endpoint string, client device.Client) (*models.TokenDetail, *models.User, error) {
+	user, err := s.authenticate(login, password)
 	if err != nil {
-		return nil, nil,
-			errors.New("usuario no encontrado")
+		return nil, nil, err
 	}
 
-	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, nil, errors.New("contraseña incorrecta")
+	if s.loginMonitor == nil {
+		return s.completeLogin(user, token.AmrPassword)
 	}
 
-	// Generate token
-	td, err := s.tokenService.CreateTokens(user)
+	assessment := s.loginMonitor.Assess(user, client, time.Now())
+	if s.loginMonitor.StepUpRequired(assessment) {
+		return nil, nil, s.startStepUp(user, client, assessment)
+	}
+
+	td, user, err := s.completeLogin(user, token.AmrPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.loginMonitor.Record(user, client, assessment, false, time.Now())
+	return td, user, nil
+}
+
+// completeLogin issues the tokens of an authenticated user. Local users whose
+// password must be changed only get a restricted token (td.Scope is set).
+func (s *Service) completeLogin(user *models.User, amr ...string) (*models.TokenDetail, *models.User, error) {
+	if user.Blocked(time.Now()) {
+		return nil, nil, ErrAccountBlocked
+	}
+
+	if passwordChangeRequired(user, time.Now()) {
+		td, err := s.issueRestrictedToken(user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return td, user, nil
+	}
+
+	td, err := s.issueTokens(user, amr...)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	return td, user, nil
+}
+
+// issueRestrictedToken saves and returns an access token only good to change
+// the password, without refresh token
+func (s *Service) issueRestrictedToken(user *models.User) (*models.TokenDetail, error) {
+	if user.Blocked(time.Now()) {
+		return nil, ErrAccountBlocked
+	}
+
+	td, err := s.tokenService.CreateRestrictedToken(user, token.ScopePasswordChange)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redisClient.SaveToken(context.Background(), td.AccessUuid, user.ID, time.Until(td.AtExpires)); err != nil {
+		return nil, err
+	}
+	return td, nil
+}
+
+// passwordChangeRequired applies the admin flag and the role's expiry policy to local users
+func passwordChangeRequired(user *models.User, now time.Time) bool {
+	if user.AuthProvider != "" && user.AuthProvider != models.AuthProviderLocal {
+		return false
+	}
+	if user.MustChangePassword {
+		return true
+	}
+	if user.Role.PasswordMaxAgeDays <= 0 {
+		return false
+	}
+	if user.PasswordChangedAt == nil {
+		return true
+	}
+	return now.After(user.PasswordChangedAt.AddDate(0, 0, user.Role.PasswordMaxAgeDays))
+}
+
+// ChangePassword replaces the password of a local user after checking the current one.
+// Every session of the user is revoked and a new token pair is returned.
+func (s *Service) ChangePassword(userID uint, currentPassword, newPassword string) (*models.TokenDetail, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+
+	if user.AuthProvider != "" && user.AuthProvider != models.AuthProviderLocal {
+		return nil, ErrPasswordManagedExternally
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		logLoginFailure(user.Email, "password change with wrong current password")
+		return nil, ErrInvalidCredentials
+	}
+
+	if currentPassword == newPassword {
+		return nil, ErrPasswordReused
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.Password = string(hashedPassword)
+	user.PasswordChangedAt = &now
+	user.MustChangePassword = false
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.redisClient.RevokeUserTokens(context.Background(), user.ID); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, token.AmrPassword)
+}
+
+// issueTokens generates a token pair for the user and saves both tokens in
+// Redis. Blocked users never get tokens, whatever the login method.
+func (s *Service) issueTokens(user *models.User, amr ...string) (*models.TokenDetail, error) {
+	return s.issueWarehouseTokens(user, "", amr...)
+}
+
+// issueWarehouseTokens is issueTokens with the warehouse claim restricted to
+// warehouse, unless it is empty
+func (s *Service) issueWarehouseTokens(user *models.User, warehouse string, amr ...string) (*models.TokenDetail, error) {
+	if user.Blocked(time.Now()) {
+		return nil, ErrAccountBlocked
+	}
+
+	// Generate token
+	var td *models.TokenDetail
+	var err error
+	if warehouse == "" {
+		td, err = s.tokenService.CreateTokens(user, amr...)
+	} else {
+		td, err = s.tokenService.CreateWarehouseTokens(user, warehouse, amr...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	// Save token in Redis
 	ctx := context.Background()
 	if err := s.redisClient.SaveToken(ctx, td.AccessUuid, user.ID, time.Until(td.AtExpires)); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	if err := s.redisClient.SaveToken(ctx, td.RefreshUuid, user.ID, time.Until(td.RtExpires)); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return td, user, nil
+	return td, nil
+}
+
+func (s *Service) authenticate(login, password string) (*models.User, error) {
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(login, password)
+		if err != nil {
+			logLoginFailure(login, authenticator.Name()+": "+err.Error())
+			continue
+		}
+		// Invited users must accept the invitation before logging in
+		if user.Status == models.UserStatusPending {
+			logLoginFailure(login, "account pending activation")
+			return nil, ErrInvalidCredentials
+		}
+		if user.Blocked(time.Now()) {
+			logLoginFailure(login, "account "+user.Status)
+			return nil, ErrAccountBlocked
+		}
+		return user, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// logLoginFailure records the real reason of a failed login in the security log
+func logLoginFailure(login, reason string) {
+	logger.Logger.Warn("Login failed",
+		zap.String("event", "login_failed"),
+		zap.String("login", login),
+		zap.String("reason", reason),
+	)
 }
 
 func (s *Service) Refresh(refreshToken string) (*models.TokenDetail, error) {
@@ -79,28 +276,71 @@ func (s *Service) Refresh(refreshToken string) (*models.TokenDetail, error) {
 		return nil, errors.New("usuario no encontrado")
 	}
 
-	// Generate new tokens
-	td, err := s.tokenService.CreateTokens(user)
-	if err != nil {
+	// Delete the old refresh token
+	if err := s.redisClient.DeleteToken(ctx, claims.TokenUuid); err != nil {
 		return nil, err
 	}
 
-	// Delete the old refresh token and save the new ones
-	if err := s.redisClient.DeleteToken(ctx, claims.TokenUuid); err != nil {
-		return nil, err
+	// The password may have been reset or expired since the login
+	if passwordChangeRequired(user, time.Now()) {
+		return s.issueRestrictedToken(user)
 	}
 
-	if err := s.redisClient.SaveToken(ctx, td.AccessUuid, user.ID, time.Until(td.AtExpires)); err != nil {
+	// The active warehouse is dropped if the user lost it since it was picked
+	warehouse := claims.ActiveWarehouse
+	if !user.CanUseWarehouse(warehouse) {
+		warehouse = ""
+	}
+
+	// Generate and save the new tokens, keeping the original authentication methods
+	return s.issueWarehouseTokens(user, warehouse, claims.Amr...)
+}
+
+// SelectWarehouse replaces the session of the access token with one whose
+// warehouse claim is restricted to one of the user's sites
+func (s *Service) SelectWarehouse(userID uint, accessUuid, refreshUuid, warehouse string, amr []string) (*models.TokenDetail, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+
+	if !user.CanUseWarehouse(warehouse) {
+		return nil, ErrWarehouseNotAssigned
+	}
+
+	td, err := s.issueWarehouseTokens(user, warehouse, amr...)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := s.redisClient.SaveToken(ctx, td.RefreshUuid, user.ID, time.Until(td.RtExpires)); err != nil {
+	// The previous tokens still carry every warehouse of the user, and the
+	// refresh token would hand them out again
+	ctx := context.Background()
+	if err := s.redisClient.DeleteToken(ctx, accessUuid); err != nil {
+		return nil, err
+	}
+	if err := s.redisClient.DeleteToken(ctx, refreshUuid); err != nil {
 		return nil, err
 	}
 
 	return td, nil
 }
 
+// Introspect returns the claims of a valid, unrevoked access token
+func (s *Service) Introspect(accessToken string) (*token.TokenClaims, error) {
+	claims, err := s.tokenService.VerifyToken(accessToken, false)
+	if err != nil {
+		return nil, errors.New("token inválido")
+	}
+
+	userID, err := s.redisClient.GetUserID(context.Background(), claims.TokenUuid)
+	if err != nil || userID != claims.UserID {
+		return nil, errors.New("token revocado o expirado")
+	}
+
+	return claims, nil
+}
+
 func (s *Service) hasPermissionForEndpoint(user *models.User, endpoint string) bool {
 	//Check if the user role has permission for the endpoint
 	for _, perm := range user.Role.Permissions {
@@ -111,6 +351,11 @@ func (s *Service) hasPermissionForEndpoint(user *models.User, endpoint string) b
 	return false
 }
 
+// RevokeSessions ends every session of the user at once
+func (s *Service) RevokeSessions(userID uint) error {
+	return s.redisClient.RevokeUserTokens(context.Background(), userID)
+}
+
 func (s *Service) Logout(userID uint, accessUuid string) error {
 	ctx := context.Background()
 	return s.redisClient.DeleteToken(ctx, accessUuid)
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/device"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/pkg/token"
+)
+
+const (
+	stepUpKeyPrefix   = "login_challenge:"
+	stepUpTTL         = 10 * time.Minute
+	stepUpMaxAttempts = 5
+)
+
+// ErrInvalidStepUp is returned for unknown, expired or exhausted challenges and wrong codes
+var ErrInvalidStepUp = errors.New("código de verificación inválido o expirado")
+
+// StepUpRequiredError is returned by Login when the login must be confirmed
+// with the code emailed to the user
+type StepUpRequiredError struct {
+	ChallengeID string
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "se requiere verificación adicional para completar el inicio de sesión"
+}
+
+type stepUpChallenge struct {
+	UserID     uint               `json:"user_id"`
+	CodeHash   string             `json:"code_hash"`
+	Attempts   int                `json:"attempts"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	Client     device.Client      `json:"client"`     // Recorded once the code is verified
+	Assessment *device.Assessment `json:"assessment"` // Recorded once the code is verified
+}
+
+// startStepUp holds the login and emails a one-time code to the user
+func (s *Service) startStepUp(user *models.User, client device.Client, assessment *device.Assessment) error {
+	code, err := randomCode()
+	if err != nil {
+		return err
+	}
+	challengeID, err := randomString()
+	if err != nil {
+		return err
+	}
+
+	challenge := stepUpChallenge{
+		UserID:     user.ID,
+		CodeHash:   hashCode(code),
+		ExpiresAt:  time.Now().Add(stepUpTTL),
+		Client:     client,
+		Assessment: assessment,
+	}
+	if err := s.saveChallenge(challengeID, challenge); err != nil {
+		return err
+	}
+
+	if err := s.loginMonitor.SendStepUpCode(user, code, stepUpTTL); err != nil {
+		return err
+	}
+
+	return &StepUpRequiredError{ChallengeID: challengeID}
+}
+
+// VerifyStepUp completes a login held for step-up MFA
+func (s *Service) VerifyStepUp(challengeID, code string) (*models.TokenDetail, *models.User, error) {
+	data, err := s.redisClient.ConsumeValue(context.Background(), stepUpKeyPrefix+challengeID)
+	if err != nil {
+		return nil, nil, ErrInvalidStepUp
+	}
+
+	var challenge stepUpChallenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		return nil, nil, ErrInvalidStepUp
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(code)), []byte(challenge.CodeHash)) != 1 {
+		challenge.Attempts++
+		logLoginFailure(fmt.Sprint(challenge.UserID), "wrong step-up code")
+		// The challenge is kept until it expires or runs out of attempts
+		if challenge.Attempts < stepUpMaxAttempts && time.Now().Before(challenge.ExpiresAt) {
+			if err := s.saveChallenge(challengeID, challenge); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, ErrInvalidStepUp
+	}
+
+	user, err := s.userRepo.FindByID(challenge.UserID)
+	if err != nil {
+		return nil, nil, errors.New("usuario no encontrado")
+	}
+
+	td, user, err := s.completeLogin(user, token.AmrPassword, token.AmrOTP)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Challenges saved before the login was recorded on verification have no assessment
+	if challenge.Assessment != nil {
+		s.loginMonitor.Record(user, challenge.Client, challenge.Assessment, true, time.Now())
+	}
+	return td, user, nil
+}
+
+func (s *Service) saveChallenge(challengeID string, challenge stepUpChallenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	return s.redisClient.SaveValue(context.Background(), stepUpKeyPrefix+challengeID, data, time.Until(challenge.ExpiresAt))
+}
+
+// randomCode returns a 6-digit numeric code
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,209 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/logger"
+	"github.com/j94veron/auth-service-insu/pkg/redis"
+)
+
+// invalidationChannel carries "roles" or "user:<id>" between replicas
+const invalidationChannel = "authz:invalidate"
+
+const invalidateRoles = "roles"
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// Cache keeps role permissions, data scope rules and user restrictions in
+// memory. Changes are announced over Redis so every replica drops its copy.
+type Cache struct {
+	ttl         time.Duration
+	redisClient *redis.Client
+
+	mu    sync.RWMutex
+	roles map[string]cacheEntry
+	users map[uint]cacheEntry
+	// Bumped on every invalidation so lookups that started before it are not stored
+	generation uint64
+}
+
+func NewCache(redisClient *redis.Client, ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:         ttl,
+		redisClient: redisClient,
+		roles:       map[string]cacheEntry{},
+		users:       map[uint]cacheEntry{},
+	}
+}
+
+// Listen applies the invalidations published by the replicas, this one
+// included, until ctx is done
+func (c *Cache) Listen(ctx context.Context) {
+	c.redisClient.Subscribe(ctx, invalidationChannel, c.drop)
+}
+
+// InvalidateRoles drops every cached role entry. Role changes reach other roles
+// through inheritance, so they are not invalidated one by one.
+func (c *Cache) InvalidateRoles() {
+	c.drop(invalidateRoles)
+	c.publish(invalidateRoles)
+}
+
+// InvalidateUser drops the cached entries of the user
+func (c *Cache) InvalidateUser(userID uint) {
+	message := fmt.Sprintf("user:%d", userID)
+	c.drop(message)
+	c.publish(message)
+}
+
+func (c *Cache) publish(message string) {
+	if err := c.redisClient.Publish(context.Background(), invalidationChannel, message); err != nil {
+		logger.Logger.Error("Error publishing cache invalidation: " + err.Error())
+	}
+}
+
+func (c *Cache) drop(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	if message == invalidateRoles {
+		c.roles = map[string]cacheEntry{}
+		return
+	}
+	if id, err := strconv.ParseUint(strings.TrimPrefix(message, "user:"), 10, 32); err == nil {
+		delete(c.users, uint(id))
+	}
+}
+
+// getRole returns the cached value, or the generation to pass to setRole
+func (c *Cache) getRole(key string) (interface{}, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.roles[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, c.generation, false
+	}
+	return entry.value, c.generation, true
+}
+
+func (c *Cache) setRole(key string, value interface{}, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.roles[key] = cacheEntry{value: value, expiresAt: time.Now().Add(c.ttl)}
+	}
+}
+
+// userRestriction is the cached answer of UserStore.IsUserRestricted
+type userRestriction struct {
+	restricted bool
+	changesAt  *time.Time
+}
+
+func (c *Cache) getUser(userID uint) (userRestriction, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.users[userID]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return userRestriction{}, c.generation, false
+	}
+	return entry.value.(userRestriction), c.generation, true
+}
+
+// setUser keeps the restriction until the TTL or until a scheduled status
+// starts or ends, whichever comes first
+func (c *Cache) setUser(userID uint, restriction userRestriction, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		expiresAt := time.Now().Add(c.ttl)
+		if restriction.changesAt != nil && restriction.changesAt.Before(expiresAt) {
+			expiresAt = *restriction.changesAt
+		}
+		c.users[userID] = cacheEntry{value: restriction, expiresAt: expiresAt}
+	}
+}
+
+// Roles returns a RoleStore that answers from the cache when it can
+func (c *Cache) Roles(store RoleStore) RoleStore {
+	return &cachedRoleStore{cache: c, store: store}
+}
+
+// Users returns a UserStore that answers from the cache when it can
+func (c *Cache) Users(store UserStore) UserStore {
+	return &cachedUserStore{cache: c, store: store}
+}
+
+type cachedRoleStore struct {
+	cache *Cache
+	store RoleStore
+}
+
+func (s *cachedRoleStore) Permissions(roleIDs []uint, method string) ([]models.Permission, error) {
+	key := "permissions:" + method + ":" + idsKey(roleIDs)
+	value, generation, ok := s.cache.getRole(key)
+	if ok {
+		return value.([]models.Permission), nil
+	}
+	permissions, err := s.store.Permissions(roleIDs, method)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.setRole(key, permissions, generation)
+	return permissions, nil
+}
+
+func (s *cachedRoleStore) DataScopes(roleID uint) ([]models.DataScopeRule, error) {
+	key := fmt.Sprintf("scopes:%d", roleID)
+	value, generation, ok := s.cache.getRole(key)
+	if ok {
+		return value.([]models.DataScopeRule), nil
+	}
+	rules, err := s.store.DataScopes(roleID)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.setRole(key, rules, generation)
+	return rules, nil
+}
+
+type cachedUserStore struct {
+	cache *Cache
+	store UserStore
+}
+
+func (s *cachedUserStore) IsUserRestricted(id uint) (bool, *time.Time, error) {
+	restriction, generation, ok := s.cache.getUser(id)
+	if ok {
+		return restriction.restricted, restriction.changesAt, nil
+	}
+	restricted, changesAt, err := s.store.IsUserRestricted(id)
+	if err != nil {
+		return false, nil, err
+	}
+	s.cache.setUser(id, userRestriction{restricted: restricted, changesAt: changesAt}, generation)
+	return restricted, changesAt, nil
+}
+
+// idsKey is the same for the same roles in any order
+func idsKey(ids []uint) string {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,111 @@
+package authz
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+// RoleStore provides the permissions and data scope rules of roles
+type RoleStore interface {
+	Permissions(roleIDs []uint, method string) ([]models.Permission, error)
+	DataScopes(roleID uint) ([]models.DataScopeRule, error)
+}
+
+// UserStore tells whether an account is restricted, and until when the answer holds
+type UserStore interface {
+	IsUserRestricted(id uint) (restricted bool, changesAt *time.Time, err error)
+}
+
+// Subject is who a decision is made for
+type Subject struct {
+	UserID  uint
+	RoleIDs []uint
+	Caller  user.Caller
+}
+
+// Decision is the result of a check; Reason explains it to people
+type Decision struct {
+	Allowed      bool   `json:"allowed"`
+	Reason       string `json:"reason"`
+	PermissionID uint   `json:"permissionId,omitempty"`
+}
+
+// ReasonRestricted is the reason of decisions denied because of the account state
+const ReasonRestricted = "account is restricted"
+
+// Engine makes the authorization decisions of PermissionMiddleware and of the
+// policy decision endpoint
+type Engine struct {
+	roles RoleStore
+	users UserStore
+}
+
+func NewEngine(roles RoleStore, users UserStore) *Engine {
+	return &Engine{
+		roles: roles,
+		users: users,
+	}
+}
+
+// Decide checks whether the subject may perform the action (an HTTP method)
+// on the resource (a route or path). When attributes of the resource are
+// given, they must also fall inside the subject's data scope.
+func (e *Engine) Decide(subject Subject, resource, action string, attributes map[string]string) (Decision, error) {
+	restricted, err := e.Restricted(subject.UserID)
+	if err != nil {
+		return Decision{}, err
+	}
+	if restricted {
+		return Decision{Reason: ReasonRestricted}, nil
+	}
+
+	permissions, err := e.roles.Permissions(subject.RoleIDs, action)
+	if err != nil {
+		return Decision{}, err
+	}
+	permission, ok := Decide(permissions, resource, action)
+	if !ok {
+		return Decision{Reason: "no permission matches " + action + " " + resource}, nil
+	}
+	if permission.Effect == models.PermissionDeny {
+		return Decision{Reason: describe("denied by", permission), PermissionID: permission.ID}, nil
+	}
+
+	if len(attributes) > 0 {
+		scope, err := e.Scope(subject)
+		if err != nil {
+			return Decision{}, err
+		}
+		if !scope.AllowsAttributes(attributes) {
+			return Decision{Reason: "resource is outside the data scope", PermissionID: permission.ID}, nil
+		}
+	}
+
+	return Decision{Allowed: true, Reason: describe("allowed by", permission), PermissionID: permission.ID}, nil
+}
+
+// Restricted reports whether the account cannot be used right now
+func (e *Engine) Restricted(userID uint) (bool, error) {
+	restricted, _, err := e.users.IsUserRestricted(userID)
+	return restricted, err
+}
+
+// Scope returns the data scope of the subject, nil when unrestricted
+func (e *Engine) Scope(subject Subject) (*user.Scope, error) {
+	rulesByRole := make([][]models.DataScopeRule, 0, len(subject.RoleIDs))
+	for _, roleID := range subject.RoleIDs {
+		rules, err := e.roles.DataScopes(roleID)
+		if err != nil {
+			return nil, err
+		}
+		rulesByRole = append(rulesByRole, rules)
+	}
+	return user.NewScope(rulesByRole, subject.Caller), nil
+}
+
+func describe(verb string, p *models.Permission) string {
+	return fmt.Sprintf("%s permission %d (%s %s)", verb, p.ID, p.Method, p.Endpoint)
+}
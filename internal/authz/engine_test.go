@@ -0,0 +1,82 @@
+package authz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+// fakeRoles answers like the role repository: the permissions of the roles
+// for the method or AnyMethod
+type fakeRoles struct {
+	permissions map[uint][]models.Permission
+	scopes      map[uint][]models.DataScopeRule
+}
+
+func (s *fakeRoles) Permissions(roleIDs []uint, method string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	for _, id := range roleIDs {
+		for _, p := range s.permissions[id] {
+			if p.Method == method || p.Method == AnyMethod {
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+func (s *fakeRoles) DataScopes(roleID uint) ([]models.DataScopeRule, error) {
+	return s.scopes[roleID], nil
+}
+
+type fakeUsers map[uint]bool
+
+func (s fakeUsers) IsUserRestricted(id uint) (bool, *time.Time, error) {
+	return s[id], nil, nil
+}
+
+func TestEngineDecide(t *testing.T) {
+	roles := &fakeRoles{
+		permissions: map[uint][]models.Permission{
+			1: {permission(1, "/api/users/*", AnyMethod, models.PermissionAllow)},
+			2: {permission(2, "/api/users/:id", "DELETE", models.PermissionDeny)},
+		},
+		scopes: map[uint][]models.DataScopeRule{
+			1: {{Attribute: models.ScopeAttributeCommercialZone, Values: []string{models.ScopeValueCommercialZone}}},
+		},
+	}
+	engine := NewEngine(roles, fakeUsers{9: true})
+	caller := user.Caller{CommercialZone: "north"}
+
+	tests := []struct {
+		name       string
+		subject    Subject
+		method     string
+		attributes map[string]string
+		allowed    bool
+		permission uint
+	}{
+		{"allowed by role", Subject{UserID: 1, RoleIDs: []uint{1}, Caller: caller}, "GET", nil, true, 1},
+		{"denied by a more specific permission of another role", Subject{UserID: 1, RoleIDs: []uint{1, 2}, Caller: caller}, "DELETE", nil, false, 2},
+		{"no permission", Subject{UserID: 1, RoleIDs: []uint{2}, Caller: caller}, "GET", nil, false, 0},
+		{"restricted account", Subject{UserID: 9, RoleIDs: []uint{1}, Caller: caller}, "GET", nil, false, 0},
+		{"inside the data scope", Subject{UserID: 1, RoleIDs: []uint{1}, Caller: caller}, "GET", map[string]string{"commercial_zone": "north"}, true, 1},
+		{"outside the data scope", Subject{UserID: 1, RoleIDs: []uint{1}, Caller: caller}, "GET", map[string]string{"commercial_zone": "south"}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := engine.Decide(tt.subject, "/api/users/:id", tt.method, tt.attributes)
+			if err != nil {
+				t.Fatalf("Decide: %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.PermissionID != tt.permission {
+				t.Fatalf("got %+v, want allowed %v by permission %d", decision, tt.allowed, tt.permission)
+			}
+			if decision.Reason == "" {
+				t.Fatal("decisions must explain their reason")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package authz
+
+import (
+	"strings"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+)
+
+// AnyMethod is the permission method that matches every HTTP method
+const AnyMethod = "*"
+
+// Match reports whether a permission endpoint pattern matches a gin route
+// (c.FullPath()). Patterns use gin syntax: ":name" matches one segment and a
+// trailing "*" or "*name" matches the rest of the path, including nothing, so
+// "/api/users/*" covers "/api/users" and "/api/users/:id".
+func Match(pattern, route string) bool {
+	patternSegments := segments(pattern)
+	routeSegments := segments(route)
+
+	for i, p := range patternSegments {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(routeSegments) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			continue
+		}
+		if p != routeSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(routeSegments)
+}
+
+// Decide returns the permission that applies to the route and method. When
+// several match, the most specific endpoint wins, then an exact method over
+// AnyMethod, then deny over allow.
+func Decide(permissions []models.Permission, route, method string) (*models.Permission, bool) {
+	var best *models.Permission
+	for i := range permissions {
+		p := &permissions[i]
+		if p.Method != method && p.Method != AnyMethod {
+			continue
+		}
+		if !Match(p.Endpoint, route) {
+			continue
+		}
+		if best == nil || moreSpecific(p, best) {
+			best = p
+		}
+	}
+	return best, best != nil
+}
+
+// Allowed reports whether the permissions allow the route and method
+func Allowed(permissions []models.Permission, route, method string) bool {
+	p, ok := Decide(permissions, route, method)
+	return ok && p.Effect != models.PermissionDeny
+}
+
+// ValidPattern checks the syntax of an endpoint pattern
+func ValidPattern(pattern string) bool {
+	if !strings.HasPrefix(pattern, "/") {
+		return false
+	}
+	parts := segments(pattern)
+	for i, p := range parts {
+		if p == "" || p == ":" {
+			return false
+		}
+		if strings.HasPrefix(p, "*") && i != len(parts)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+func moreSpecific(a, b *models.Permission) bool {
+	if c := compareSpecificity(a.Endpoint, b.Endpoint); c != 0 {
+		return c > 0
+	}
+	if (a.Method == AnyMethod) != (b.Method == AnyMethod) {
+		return b.Method == AnyMethod
+	}
+	if (a.Effect == models.PermissionDeny) != (b.Effect == models.PermissionDeny) {
+		return a.Effect == models.PermissionDeny
+	}
+	// Same precedence, the oldest permission wins
+	return a.ID < b.ID
+}
+
+// compareSpecificity compares two patterns segment by segment: a literal beats
+// a parameter, which beats a wildcard; otherwise the longer pattern wins
+func compareSpecificity(a, b string) int {
+	as, bs := segments(a), segments(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if d := segmentRank(as[i]) - segmentRank(bs[i]); d != 0 {
+			return d
+		}
+	}
+	return len(as) - len(bs)
+}
+
+func segmentRank(segment string) int {
+	switch {
+	case strings.HasPrefix(segment, "*"):
+		return 0
+	case strings.HasPrefix(segment, ":"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func segments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,126 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		route   string
+		want    bool
+	}{
+		{"/api/users", "/api/users", true},
+		{"/api/users", "/api/users/:id", false},
+		{"/api/users/:id", "/api/users/:id", true},
+		{"/api/users/:id", "/api/users", false},
+		{"/api/users/:userId", "/api/users/:id", true},
+		{"/api/users/*", "/api/users", true},
+		{"/api/users/*", "/api/users/:id/identities", true},
+		{"/api/users/*rest", "/api/users/:id", true},
+		{"/api/users/*", "/api/usersx", false},
+		{"/api/*", "/api/roles/:id", true},
+		{"/api/roles", "/api/users", false},
+		{"/api/users/", "/api/users", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.route); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestValidPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"/api/users", true},
+		{"/api/users/:id", true},
+		{"/api/users/*", true},
+		{"/api/users/*rest", true},
+		{"/", true},
+		{"api/users", false},
+		{"", false},
+		{"/api//users", false},
+		{"/api/users/:", false},
+		{"/api/*/users", false},
+	}
+	for _, tt := range tests {
+		if got := ValidPattern(tt.pattern); got != tt.want {
+			t.Errorf("ValidPattern(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func permission(id uint, endpoint, method, effect string) models.Permission {
+	return models.Permission{ID: id, Endpoint: endpoint, Method: method, Effect: effect}
+}
+
+func TestDecidePrecedence(t *testing.T) {
+	const allow, deny = models.PermissionAllow, models.PermissionDeny
+	tests := []struct {
+		name        string
+		permissions []models.Permission
+		route       string
+		method      string
+		want        uint // 0 when nothing applies
+	}{
+		{
+			"nothing matches",
+			[]models.Permission{permission(1, "/api/roles", "GET", allow)},
+			"/api/users", "GET", 0,
+		},
+		{
+			"other methods do not apply",
+			[]models.Permission{permission(1, "/api/users", "POST", allow)},
+			"/api/users", "GET", 0,
+		},
+		{
+			"literal segment beats parameter",
+			[]models.Permission{permission(1, "/api/users/:id", "GET", deny), permission(2, "/api/users/me", "GET", allow)},
+			"/api/users/me", "GET", 2,
+		},
+		{
+			"parameter beats wildcard",
+			[]models.Permission{permission(1, "/api/users/*", "GET", deny), permission(2, "/api/users/:id", "GET", allow)},
+			"/api/users/:id", "GET", 2,
+		},
+		{
+			"specific endpoint beats exact method",
+			[]models.Permission{permission(1, "/api/*", "GET", deny), permission(2, "/api/users", AnyMethod, allow)},
+			"/api/users", "GET", 2,
+		},
+		{
+			"exact method beats any method",
+			[]models.Permission{permission(1, "/api/users", AnyMethod, deny), permission(2, "/api/users", "GET", allow)},
+			"/api/users", "GET", 2,
+		},
+		{
+			"deny beats allow",
+			[]models.Permission{permission(1, "/api/users", "GET", allow), permission(2, "/api/users", "GET", deny)},
+			"/api/users", "GET", 2,
+		},
+		{
+			"oldest wins on a tie",
+			[]models.Permission{permission(3, "/api/users", "GET", allow), permission(2, "/api/users", "GET", allow)},
+			"/api/users", "GET", 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := Decide(tt.permissions, tt.route, tt.method)
+			if tt.want == 0 {
+				if ok {
+					t.Fatalf("got permission %d, want none", p.ID)
+				}
+				return
+			}
+			if !ok || p.ID != tt.want {
+				t.Fatalf("got %v (ok %v), want permission %d", p, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetEnvList returns a comma separated environment variable as a list, skipping empty items
+func GetEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// GetEnvInt returns an integer environment variable, or def when it is missing or invalid
+func GetEnvInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,85 @@
+package device
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindDevice(userID uint, fingerprint string) (*models.KnownDevice, error)
+	CountDevices(userID uint) (int64, error)
+	SaveDevice(device *models.KnownDevice) error
+	CreateLoginEvent(event *models.LoginEvent) error
+	LastLocatedLogin(userID uint) (*models.LoginEvent, error)
+	KnownCountries(userID uint) ([]string, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) FindDevice(userID uint, fingerprint string) (*models.KnownDevice, error) {
+	var device models.KnownDevice
+	if err := r.db.Where("user_id = ? AND fingerprint = ?", userID, fingerprint).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("device not found")
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (r *repository) CountDevices(userID uint) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.KnownDevice{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *repository) SaveDevice(device *models.KnownDevice) error {
+	return r.db.Save(device).Error
+}
+
+func (r *repository) CreateLoginEvent(event *models.LoginEvent) error {
+	return r.db.Create(event).Error
+}
+
+// completedLogins excludes logins held for step-up MFA that were never verified
+func completedLogins(db *gorm.DB) *gorm.DB {
+	return db.Where("step_up = ? OR step_up_verified = ?", false, true)
+}
+
+// LastLocatedLogin returns the latest completed login with a known location
+func (r *repository) LastLocatedLogin(userID uint) (*models.LoginEvent, error) {
+	var event models.LoginEvent
+	err := r.db.Scopes(completedLogins).Where("user_id = ? AND has_location = ?", userID, true).
+		Order("created_at DESC").
+		First(&event).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("no previous login")
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// KnownCountries returns the countries the user has completed logins from
+func (r *repository) KnownCountries(userID uint) ([]string, error) {
+	var countries []string
+	err := r.db.Model(&models.LoginEvent{}).Scopes(completedLogins).
+		Where("user_id = ? AND country <> ''", userID).
+		Distinct().
+		Pluck("country", &countries).Error
+	if err != nil {
+		return nil, err
+	}
+	return countries, nil
+}
@@ -0,0 +1,266 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/logger"
+	"github.com/j94veron/auth-service-insu/pkg/mailer"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Findings that make a login suspicious
+const (
+	FindingNewDevice        = "new_device"
+	FindingUnusualCountry   = "unusual_country"
+	FindingImpossibleTravel = "impossible_travel"
+)
+
+// Client describes where a login comes from
+type Client struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	DeviceID  string `json:"device_id"` // Optional ID sent by apps that can persist one
+}
+
+// Config configures login assessment
+type Config struct {
+	GeoIPPath         string   // MaxMind City database file; empty disables location checks
+	MaxTravelSpeedKmh float64  // Faster moves between logins are impossible travel
+	MinTravelKm       float64  // Shorter moves are ignored, GeoIP is not precise enough
+	StepUpOn          []string // Findings that require step-up MFA
+}
+
+// Assessment is the result of checking a login against the user's history
+type Assessment struct {
+	Fingerprint string   `json:"fingerprint"`
+	Country     string   `json:"country"`
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	HasLocation bool     `json:"has_location"`
+	Findings    []string `json:"findings"`
+}
+
+// Suspicious reports whether the login should be notified to the user
+func (a *Assessment) Suspicious() bool {
+	return len(a.Findings) > 0
+}
+
+func (a *Assessment) has(finding string) bool {
+	for _, f := range a.Findings {
+		if f == finding {
+			return true
+		}
+	}
+	return false
+}
+
+type Usecase struct {
+	repo   Repository
+	mailer mailer.Mailer
+	geoip  *geoip2.Reader
+	config Config
+}
+
+// NewUsecase opens the GeoIP database when configured. Without it only new
+// devices are detected.
+func NewUsecase(repo Repository, mailer mailer.Mailer, config Config) (*Usecase, error) {
+	u := &Usecase{
+		repo:   repo,
+		mailer: mailer,
+		config: config,
+	}
+	if config.GeoIPPath != "" {
+		reader, err := geoip2.Open(config.GeoIPPath)
+		if err != nil {
+			return nil, err
+		}
+		u.geoip = reader
+	}
+	return u, nil
+}
+
+// Assess fingerprints the login and compares it with the user's previous logins
+func (u *Usecase) Assess(user *models.User, client Client, now time.Time) *Assessment {
+	a := &Assessment{Fingerprint: fingerprint(client)}
+	u.locate(client.IP, a)
+
+	// The very first device of a user is not news
+	if _, err := u.repo.FindDevice(user.ID, a.Fingerprint); err != nil {
+		if count, err := u.repo.CountDevices(user.ID); err == nil && count > 0 {
+			a.Findings = append(a.Findings, FindingNewDevice)
+		}
+	}
+
+	if a.Country != "" {
+		countries, err := u.repo.KnownCountries(user.ID)
+		if err == nil && len(countries) > 0 && !contains(countries, a.Country) {
+			a.Findings = append(a.Findings, FindingUnusualCountry)
+		}
+	}
+
+	if a.HasLocation {
+		if last, err := u.repo.LastLocatedLogin(user.ID); err == nil && u.impossibleTravel(last, a, now) {
+			a.Findings = append(a.Findings, FindingImpossibleTravel)
+		}
+	}
+
+	return a
+}
+
+// StepUpRequired reports whether the policy asks for MFA on this login
+func (u *Usecase) StepUpRequired(a *Assessment) bool {
+	for _, finding := range u.config.StepUpOn {
+		if a.has(finding) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record saves the device and the login event of a completed login, and
+// notifies the user of suspicious logins. stepUp tells the login was confirmed
+// with a step-up code.
+func (u *Usecase) Record(user *models.User, client Client, a *Assessment, stepUp bool, now time.Time) {
+	device, err := u.repo.FindDevice(user.ID, a.Fingerprint)
+	if err != nil {
+		device = &models.KnownDevice{
+			UserID:      user.ID,
+			Fingerprint: a.Fingerprint,
+			FirstSeenAt: now,
+		}
+	}
+	device.DeviceID = client.DeviceID
+	device.UserAgent = truncate(client.UserAgent, 512)
+	device.LastIP = client.IP
+	device.LastCountry = a.Country
+	device.LastSeenAt = now
+	if err := u.repo.SaveDevice(device); err != nil {
+		logger.Logger.Error("Error saving known device: " + err.Error())
+	}
+
+	event := &models.LoginEvent{
+		UserID:           user.ID,
+		IP:               client.IP,
+		UserAgent:        truncate(client.UserAgent, 512),
+		DeviceID:         client.DeviceID,
+		Country:          a.Country,
+		Latitude:         a.Latitude,
+		Longitude:        a.Longitude,
+		HasLocation:      a.HasLocation,
+		NewDevice:        a.has(FindingNewDevice),
+		UnusualCountry:   a.has(FindingUnusualCountry),
+		ImpossibleTravel: a.has(FindingImpossibleTravel),
+		StepUp:           stepUp,
+		StepUpVerified:   stepUp,
+		CreatedAt:        now,
+	}
+	if err := u.repo.CreateLoginEvent(event); err != nil {
+		logger.Logger.Error("Error saving login event: " + err.Error())
+	}
+
+	if a.Suspicious() {
+		go u.notify(user, client, a, now)
+	}
+}
+
+func (u *Usecase) notify(user *models.User, client Client, a *Assessment, now time.Time) {
+	location := a.Country
+	if location == "" {
+		location = "desconocida"
+	}
+
+	body := "Hola " + user.Name + ",\n\n" +
+		"Detectamos un inicio de sesión en tu cuenta que no reconocemos:\n\n" +
+		"Fecha: " + now.Format("02/01/2006 15:04 MST") + "\n" +
+		"IP: " + client.IP + "\n" +
+		"Ubicación: " + location + "\n" +
+		"Dispositivo: " + client.UserAgent + "\n" +
+		"Motivo: " + strings.Join(a.Findings, ", ") + "\n\n" +
+		"Si no fuiste vos, cambiá tu contraseña y avisá a un administrador.\n"
+
+	if err := u.mailer.Send(user.Email, "Nuevo inicio de sesión en tu cuenta", body); err != nil {
+		logger.Logger.Error("Error sending login notification: " + err.Error())
+	}
+}
+
+func (u *Usecase) locate(ip string, a *Assessment) {
+	if u.geoip == nil {
+		return
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() {
+		return
+	}
+	city, err := u.geoip.City(parsed)
+	if err != nil {
+		return
+	}
+	a.Country = city.Country.IsoCode
+	if city.Location.Latitude != 0 || city.Location.Longitude != 0 {
+		a.Latitude = city.Location.Latitude
+		a.Longitude = city.Location.Longitude
+		a.HasLocation = true
+	}
+}
+
+func (u *Usecase) impossibleTravel(last *models.LoginEvent, a *Assessment, now time.Time) bool {
+	distance := haversineKm(last.Latitude, last.Longitude, a.Latitude, a.Longitude)
+	if distance < u.config.MinTravelKm {
+		return false
+	}
+	hours := now.Sub(last.CreatedAt).Hours()
+	if hours <= 0 {
+		return true
+	}
+	return distance/hours > u.config.MaxTravelSpeedKmh
+}
+
+// fingerprint prefers the app device ID and falls back to the user agent
+func fingerprint(client Client) string {
+	source := "ua:" + client.UserAgent
+	if client.DeviceID != "" {
+		source = "device:" + client.DeviceID
+	}
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// SendStepUpCode emails the one-time code that completes a login held for step-up MFA
+func (u *Usecase) SendStepUpCode(user *models.User, code string, ttl time.Duration) error {
+	body := "Hola " + user.Name + ",\n\n" +
+		"Tu código para completar el inicio de sesión es: " + code + "\n\n" +
+		"El código vence en " + ttl.String() + ". Si no intentaste ingresar, cambiá tu contraseña.\n"
+
+	return u.mailer.Send(user.Email, "Código de verificación", body)
+}
@@ -0,0 +1,50 @@
+package federation
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindBySubject(provider, subject string) (*models.FederatedIdentity, error)
+	Create(identity *models.FederatedIdentity) error
+	ListByUser(userID uint) ([]models.FederatedIdentity, error)
+	Delete(id uint) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) FindBySubject(provider, subject string) (*models.FederatedIdentity, error) {
+	var identity models.FederatedIdentity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("identity not found")
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *repository) Create(identity *models.FederatedIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *repository) ListByUser(userID uint) ([]models.FederatedIdentity, error) {
+	var identities []models.FederatedIdentity
+	if err := r.db.Where("user_id = ?", userID).Order("provider, subject").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *repository) Delete(id uint) error {
+	return r.db.Delete(&models.FederatedIdentity{}, id).Error
+}
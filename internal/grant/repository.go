@@ -0,0 +1,95 @@
+package grant
+
+import (
+	"errors"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindByID(id uint) (*models.RoleGrant, error)
+	Create(grant *models.RoleGrant) error
+	Update(grant *models.RoleGrant) error
+	List(status string, userID uint) ([]models.RoleGrant, error)
+	ListExpired(now time.Time) ([]models.RoleGrant, error)
+	End(id uint, status string, at time.Time) (bool, error)
+
+	// ForTenant returns a repository whose FindByID and List only reach grants
+	// of users of the tenant
+	ForTenant(tenantID uint) Repository
+}
+
+type repository struct {
+	db       *gorm.DB
+	tenantID uint // 0 reaches every tenant
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ForTenant(tenantID uint) Repository {
+	return &repository{db: r.db, tenantID: tenantID}
+}
+
+// query starts a role grants query limited to users of the tenant
+func (r *repository) query() *gorm.DB {
+	if r.tenantID == 0 {
+		return r.db
+	}
+	return r.db.Where("role_grants.user_id IN (SELECT id FROM users WHERE tenant_id = ?)", r.tenantID)
+}
+
+func (r *repository) FindByID(id uint) (*models.RoleGrant, error) {
+	var grant models.RoleGrant
+	if err := r.query().Preload("Role").First(&grant, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("role grant not found")
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *repository) Create(grant *models.RoleGrant) error {
+	return r.db.Omit("User", "Role").Create(grant).Error
+}
+
+func (r *repository) Update(grant *models.RoleGrant) error {
+	return r.db.Omit("User", "Role").Save(grant).Error
+}
+
+// List returns grants filtered by status and user; empty filters match all
+func (r *repository) List(status string, userID uint) ([]models.RoleGrant, error) {
+	var grants []models.RoleGrant
+	query := r.query().Preload("User").Preload("Role").Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// ListExpired returns approved grants whose window is over
+func (r *repository) ListExpired(now time.Time) ([]models.RoleGrant, error) {
+	var grants []models.RoleGrant
+	err := r.db.Where("status = ? AND valid_until IS NOT NULL AND valid_until <= ?", models.RoleGrantApproved, now).
+		Find(&grants).Error
+	return grants, err
+}
+
+// End moves an approved grant to status. It reports false when the grant was
+// not approved anymore, so concurrent replicas end each grant once.
+func (r *repository) End(id uint, status string, at time.Time) (bool, error) {
+	result := r.db.Model(&models.RoleGrant{}).
+		Where("id = ? AND status = ?", id, models.RoleGrantApproved).
+		Updates(map[string]interface{}{"status": status, "ended_at": at})
+	return result.RowsAffected > 0, result.Error
+}
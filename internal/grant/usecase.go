@@ -0,0 +1,309 @@
+package grant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/logger"
+	"github.com/j94veron/auth-service-insu/pkg/redis"
+)
+
+// ErrInvalidWindow is returned for windows that end before they start or last too long
+var ErrInvalidWindow = errors.New("invalid grant window")
+
+// ErrNotRequestable is returned when requesting a role that does not require approval
+var ErrNotRequestable = errors.New("role cannot be requested, ask an administrator")
+
+// ErrSelfApproval is returned when approving or granting access for oneself or one's own request
+var ErrSelfApproval = errors.New("grants must be approved by another administrator")
+
+// ErrApprovalRequired is returned when granting an elevated role directly
+var ErrApprovalRequired = errors.New("role requires approval, it must be requested and approved")
+
+// ErrGrantClosed is returned when deciding or revoking a grant that is no longer open
+var ErrGrantClosed = errors.New("role grant already decided or ended")
+
+// Window is the period a grant gives its role
+type Window struct {
+	From  *time.Time // Defaults to now
+	Until *time.Time
+}
+
+type Usecase struct {
+	repo        Repository
+	userRepo    user.Repository
+	roleRepo    role.Repository
+	redisClient *redis.Client
+	scope       *user.Scope // Users the caller may grant roles to, nil for all
+}
+
+func NewUsecase(repo Repository, userRepo user.Repository, roleRepo role.Repository, redisClient *redis.Client) *Usecase {
+	return &Usecase{
+		repo:        repo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		redisClient: redisClient,
+	}
+}
+
+// ForTenant returns a usecase that only reaches users, roles and grants of the tenant
+func (u *Usecase) ForTenant(tenantID uint) *Usecase {
+	return &Usecase{
+		repo:        u.repo.ForTenant(tenantID),
+		userRepo:    u.userRepo.ForTenant(tenantID),
+		roleRepo:    u.roleRepo.ForTenant(tenantID),
+		redisClient: u.redisClient,
+		scope:       u.scope,
+	}
+}
+
+// WithScope returns a usecase that only grants, decides, revokes and lists
+// roles of users inside the caller's data scope
+func (u *Usecase) WithScope(scope *user.Scope) *Usecase {
+	return &Usecase{
+		repo:        u.repo,
+		userRepo:    u.userRepo.WithScope(scope),
+		roleRepo:    u.roleRepo,
+		redisClient: u.redisClient,
+		scope:       scope,
+	}
+}
+
+// Grant gives the role to another user right away. Elevated roles only go
+// through Request and Approve, so that two people take part.
+func (u *Usecase) Grant(userID, roleID uint, window Window, reason string, actorID uint) (*models.RoleGrant, error) {
+	if userID == actorID {
+		return nil, ErrSelfApproval
+	}
+	r, err := u.roleRepo.FindByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+	if r.RequiresApproval {
+		return nil, ErrApprovalRequired
+	}
+	if _, err := u.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+
+	from, err := checkWindow(r, window, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	grant := &models.RoleGrant{
+		UserID:      userID,
+		RoleID:      roleID,
+		Reason:      reason,
+		Status:      models.RoleGrantApproved,
+		ValidFrom:   from,
+		ValidUntil:  window.Until,
+		RequestedBy: actorID,
+		DecidedBy:   &actorID,
+		DecidedAt:   &now,
+	}
+	if err := u.repo.Create(grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// Request asks for an elevated role for a bounded window; it waits for approval
+func (u *Usecase) Request(userID, roleID uint, window Window, reason string) (*models.RoleGrant, error) {
+	r, err := u.roleRepo.FindByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.RequiresApproval {
+		return nil, ErrNotRequestable
+	}
+
+	from, err := checkWindow(r, window, true)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &models.RoleGrant{
+		UserID:      userID,
+		RoleID:      roleID,
+		Reason:      reason,
+		Status:      models.RoleGrantPending,
+		ValidFrom:   from,
+		ValidUntil:  window.Until,
+		RequestedBy: userID,
+	}
+	if err := u.repo.Create(grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// Approve accepts a pending request. Nobody approves their own access.
+func (u *Usecase) Approve(id, actorID uint) (*models.RoleGrant, error) {
+	return u.decide(id, actorID, models.RoleGrantApproved)
+}
+
+func (u *Usecase) Reject(id, actorID uint) (*models.RoleGrant, error) {
+	return u.decide(id, actorID, models.RoleGrantRejected)
+}
+
+func (u *Usecase) decide(id, actorID uint, status string) (*models.RoleGrant, error) {
+	grant, err := u.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if grant.Status != models.RoleGrantPending {
+		return nil, ErrGrantClosed
+	}
+	if status == models.RoleGrantApproved {
+		if actorID == grant.UserID || actorID == grant.RequestedBy {
+			return nil, ErrSelfApproval
+		}
+		if grant.ValidUntil != nil && !time.Now().Before(*grant.ValidUntil) {
+			return nil, ErrInvalidWindow
+		}
+	}
+
+	now := time.Now()
+	grant.Status = status
+	grant.DecidedBy = &actorID
+	grant.DecidedAt = &now
+	if err := u.repo.Update(grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// Revoke ends a pending or approved grant and the sessions that may carry its role
+func (u *Usecase) Revoke(id, actorID uint) (*models.RoleGrant, error) {
+	grant, err := u.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch grant.Status {
+	case models.RoleGrantPending:
+		grant.Status = models.RoleGrantRevoked
+		grant.DecidedBy = &actorID
+		grant.DecidedAt = &now
+		grant.EndedAt = &now
+		if err := u.repo.Update(grant); err != nil {
+			return nil, err
+		}
+		return grant, nil
+	case models.RoleGrantApproved:
+		ended, err := u.repo.End(grant.ID, models.RoleGrantRevoked, now)
+		if err != nil {
+			return nil, err
+		}
+		if !ended {
+			return nil, ErrGrantClosed
+		}
+		grant.Status = models.RoleGrantRevoked
+		grant.EndedAt = &now
+		if err := u.revokeSessions(grant); err != nil {
+			return nil, err
+		}
+		return grant, nil
+	default:
+		return nil, ErrGrantClosed
+	}
+}
+
+func (u *Usecase) List(status string, userID uint) ([]models.RoleGrant, error) {
+	grants, err := u.repo.List(status, userID)
+	if err != nil || u.scope == nil {
+		return grants, err
+	}
+	visible := []models.RoleGrant{}
+	for _, grant := range grants {
+		if grant.User != nil && u.scope.Allows(grant.User) {
+			visible = append(visible, grant)
+		}
+	}
+	return visible, nil
+}
+
+// find loads the grant, hiding the ones of users outside the scope
+func (u *Usecase) find(id uint) (*models.RoleGrant, error) {
+	grant, err := u.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.userRepo.FindByID(grant.UserID); err != nil {
+		return nil, errors.New("role grant not found")
+	}
+	return grant, nil
+}
+
+// ExpireDue ends the approved grants whose window is over
+func (u *Usecase) ExpireDue(now time.Time) error {
+	grants, err := u.repo.ListExpired(now)
+	if err != nil {
+		return err
+	}
+	for i := range grants {
+		grant := &grants[i]
+		ended, err := u.repo.End(grant.ID, models.RoleGrantExpired, now)
+		if err != nil {
+			return err
+		}
+		if !ended {
+			continue
+		}
+		if err := u.revokeSessions(grant); err != nil {
+			logger.Logger.Error(fmt.Sprintf("Error revoking sessions of expired role grant %d: %s", grant.ID, err.Error()))
+		}
+	}
+	return nil
+}
+
+// RunExpiry calls ExpireDue every interval until ctx is done
+func (u *Usecase) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := u.ExpireDue(now); err != nil {
+				logger.Logger.Error("Error expiring role grants: " + err.Error())
+			}
+		}
+	}
+}
+
+// revokeSessions ends every session of the grant's user. Tokens only carry
+// role IDs, so the sessions holding the granted role cannot be told apart.
+func (u *Usecase) revokeSessions(grant *models.RoleGrant) error {
+	return u.redisClient.RevokeUserTokens(context.Background(), grant.UserID)
+}
+
+// checkWindow validates the window against the role's limit and returns its start
+func checkWindow(r *models.Role, window Window, requireEnd bool) (time.Time, error) {
+	from := time.Now()
+	if window.From != nil && window.From.After(from) {
+		from = *window.From
+	}
+	if window.Until == nil {
+		if requireEnd || r.MaxGrantHours > 0 {
+			return from, ErrInvalidWindow
+		}
+		return from, nil
+	}
+	if !window.Until.After(from) {
+		return from, ErrInvalidWindow
+	}
+	if r.MaxGrantHours > 0 && window.Until.Sub(from) > time.Duration(r.MaxGrantHours)*time.Hour {
+		return from, ErrInvalidWindow
+	}
+	return from, nil
+}
@@ -0,0 +1,170 @@
+package grant
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+func TestCheckWindow(t *testing.T) {
+	now := time.Now()
+	in := func(d time.Duration) *time.Time {
+		at := now.Add(d)
+		return &at
+	}
+	unlimited := &models.Role{}
+	limited := &models.Role{MaxGrantHours: 8}
+
+	tests := []struct {
+		name       string
+		role       *models.Role
+		window     Window
+		requireEnd bool
+		valid      bool
+	}{
+		{"open-ended grant", unlimited, Window{}, false, true},
+		{"open-ended request", unlimited, Window{}, true, false},
+		{"open-ended grant of a limited role", limited, Window{}, false, false},
+		{"bounded", unlimited, Window{Until: in(time.Hour)}, true, true},
+		{"ends in the past", unlimited, Window{Until: in(-time.Hour)}, false, false},
+		{"ends before it starts", unlimited, Window{From: in(2 * time.Hour), Until: in(time.Hour)}, false, false},
+		{"within the limit", limited, Window{Until: in(8*time.Hour - time.Minute)}, true, true},
+		{"over the limit", limited, Window{Until: in(9 * time.Hour)}, true, false},
+		{"limit counts from a future start", limited, Window{From: in(24 * time.Hour), Until: in(30 * time.Hour)}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkWindow(tt.role, tt.window, tt.requireEnd)
+			if tt.valid && err != nil {
+				t.Fatalf("got %v, want a valid window", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidWindow) {
+				t.Fatalf("got %v, want ErrInvalidWindow", err)
+			}
+		})
+	}
+}
+
+func TestCheckWindowStartsNowUnlessLater(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	from, err := checkWindow(&models.Role{}, Window{From: &past}, false)
+	if err != nil || from.Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("got %v (%v), want grants to start no earlier than now", from, err)
+	}
+}
+
+// fakeGrants keeps grants in memory
+type fakeGrants struct {
+	Repository
+	grants []*models.RoleGrant
+}
+
+func (r *fakeGrants) Create(grant *models.RoleGrant) error {
+	grant.ID = uint(len(r.grants) + 1)
+	r.grants = append(r.grants, grant)
+	return nil
+}
+
+func (r *fakeGrants) FindByID(id uint) (*models.RoleGrant, error) {
+	if id == 0 || int(id) > len(r.grants) {
+		return nil, errors.New("role grant not found")
+	}
+	return r.grants[id-1], nil
+}
+
+func (r *fakeGrants) Update(grant *models.RoleGrant) error {
+	return nil
+}
+
+type fakeUsers struct {
+	user.Repository
+}
+
+func (r *fakeUsers) FindByID(id uint) (*models.User, error) {
+	return &models.User{ID: id}, nil
+}
+
+type fakeRoles struct {
+	role.Repository
+}
+
+// FindByID returns an elevated role for odd IDs
+func (r *fakeRoles) FindByID(id uint) (*models.Role, error) {
+	return &models.Role{ID: id, RequiresApproval: id%2 == 1}, nil
+}
+
+const (
+	elevatedRole = 1
+	regularRole  = 2
+)
+
+func newUsecase() *Usecase {
+	return NewUsecase(&fakeGrants{}, &fakeUsers{}, &fakeRoles{}, nil)
+}
+
+func TestGrant(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  uint
+		roleID  uint
+		actorID uint
+		err     error
+	}{
+		{"regular role to another user", 10, regularRole, 20, nil},
+		{"to oneself", 20, regularRole, 20, ErrSelfApproval},
+		{"elevated role", 10, elevatedRole, 20, ErrApprovalRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant, err := newUsecase().Grant(tt.userID, tt.roleID, Window{}, "reason", tt.actorID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err == nil && (grant.Status != models.RoleGrantApproved || grant.DecidedBy == nil || *grant.DecidedBy != tt.actorID) {
+				t.Fatalf("got %+v, want a grant approved by the actor", grant)
+			}
+		})
+	}
+}
+
+func TestRequestAndApprove(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	window := Window{Until: &until}
+
+	if _, err := newUsecase().Request(10, regularRole, window, "reason"); !errors.Is(err, ErrNotRequestable) {
+		t.Fatalf("got %v, want roles without approval to be refused", err)
+	}
+
+	tests := []struct {
+		name    string
+		actorID uint
+		err     error
+	}{
+		{"by another administrator", 20, nil},
+		{"by the requester", 10, ErrSelfApproval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUsecase()
+			requested, err := u.Request(10, elevatedRole, window, "reason")
+			if err != nil || requested.Status != models.RoleGrantPending {
+				t.Fatalf("Request: %v", err)
+			}
+
+			approved, err := u.Approve(requested.ID, tt.actorID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err == nil && approved.Status != models.RoleGrantApproved {
+				t.Fatalf("got status %q, want approved", approved.Status)
+			}
+			if _, err := u.Approve(requested.ID, 30); err == nil && tt.err == nil {
+				t.Fatal("a decided grant must not be approved again")
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/apikey"
+)
+
+type APIKeyHandler struct {
+	apiKeys *apikey.Usecase
+}
+
+func NewAPIKeyHandler(apiKeys *apikey.Usecase) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeys: apiKeys,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future"})
+		return
+	}
+
+	// The key acts with the caller's roles, so it is always owned by the caller
+	plainKey, key, err := h.apiKeys.ForTenant(c.GetUint("tenantID")).Generate(req.Name, c.GetUint("userID"), req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, apikey.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The plain key is only returned once
+	c.JSON(http.StatusCreated, gin.H{"apiKey": key, "key": plainKey})
+}
+
+// List returns the caller's own keys
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.apiKeys.ForTenant(c.GetUint("tenantID")).List(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if err := h.apiKeys.ForTenant(c.GetUint("tenantID")).Revoke(uint(id), c.GetUint("userID")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/j94veron/auth-service-insu/internal/auth"
+	"github.com/j94veron/auth-service-insu/internal/device"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/pkg/token"
 )
 
 type AuthHandler struct {
@@ -17,10 +22,14 @@ func NewAuthHandler(authService *auth.Service) *AuthHandler {
 	}
 }
 
+// LoginRequest accepts either an email or a username
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required_without=Username,omitempty,email"`
+	Username string `json:"username" binding:"required_without=Email,omitempty,excludes=@"`
 	Password string `json:"password" binding:"required"`
 	Endpoint string `json:"endpoint"`
+	// Optional ID of the device, apps may also send it in the X-Device-ID header
+	DeviceID string `json:"deviceId" binding:"max=128"`
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -30,27 +39,110 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	tokens, user, err := h.authService.Login(req.Email, req.Password, req.Endpoint)
+	login := req.Email
+	if login == "" {
+		login = req.Username
+	}
+
+	client := device.Client{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		DeviceID:  req.DeviceID,
+	}
+	if client.DeviceID == "" {
+		client.DeviceID = c.GetHeader("X-Device-ID")
+	}
+
+	tokens, user, err := h.authService.Login(login, req.Password, req.Endpoint, client)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		var stepUp *auth.StepUpRequiredError
+		if errors.As(err, &stepUp) {
+			c.JSON(http.StatusAccepted, gin.H{"mfa_required": true, "challenge_id": stepUp.ChallengeID})
+			return
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": auth.ErrCodeInvalidCredentials})
+			return
+		}
+		if errors.Is(err, auth.ErrAccountBlocked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": auth.ErrCodeAccountBlocked})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, loginResponse(tokens, user))
+}
+
+type VerifyStepUpRequest struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	Code        string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// VerifyStepUp completes a login that required a code sent by email
+func (h *AuthHandler) VerifyStepUp(c *gin.Context) {
+	var req VerifyStepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := h.authService.VerifyStepUp(req.ChallengeID, req.Code)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidStepUp) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, auth.ErrAccountBlocked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": auth.ErrCodeAccountBlocked})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens, user))
+}
+
+// loginResponse builds the body returned after a successful login
+func loginResponse(tokens *models.TokenDetail, user *models.User) gin.H {
+	response := gin.H{
 		"access_token":  tokens.AccessToken,
 		"refresh_token": tokens.RefreshToken,
 		"user": gin.H{
 			"name":           user.Name,
 			"lastName":       user.LastName,
 			"email":          user.Email,
+			"userName":       user.UserName,
 			"commercialZone": user.CommercialZone,
 			"warehouse":      user.Warehouse,
 			"role":           user.Role.Name,
-			"otherWarehouse": user.OtherWarehouse,
+			"roles":          roleNames(user),
+			"otherWarehouse": user.OtherWarehouseCodes(),
 			"province":       user.Province,
-			"reports":        user.Reports,
+			"reports":        user.ReportCodes(time.Now()),
 		},
-	})
+	}
+
+	// Restricted tokens can only be used to change the password
+	if tokens.Scope == token.ScopePasswordChange {
+		delete(response, "refresh_token")
+		response["password_change_required"] = true
+	}
+
+	return response
+}
+
+// roleNames lists the names of every role of the user, the primary one first
+func roleNames(user *models.User) []string {
+	names := []string{user.Role.Name}
+	for _, role := range user.Roles {
+		if role.ID != user.RoleID {
+			names = append(names, role.Name)
+		}
+	}
+	return names
 }
 
 type RefreshRequest struct {
@@ -70,9 +162,65 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
+	// Restricted tokens can only be used to change the password
+	if tokens.Scope == token.ScopePasswordChange {
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":             tokens.AccessToken,
+			"password_change_required": true,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+type SelectWarehouseRequest struct {
+	Warehouse string `json:"warehouse" binding:"required"`
+}
+
+// SelectWarehouse reissues the caller's tokens restricted to one of their warehouses
+func (h *AuthHandler) SelectWarehouse(c *gin.Context) {
+	var req SelectWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// API keys have no session to reissue
+	tokenUuid := c.GetString("tokenUuid")
+	if tokenUuid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only user sessions can select a warehouse"})
+		return
+	}
+
+	// Tokens issued before they carried their refresh token cannot end their session
+	refreshUuid := c.GetString("refreshUuid")
+	if refreshUuid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign in again to select a warehouse"})
+		return
+	}
+
+	amr := c.GetStringSlice("amr")
+	tokens, err := h.authService.SelectWarehouse(c.GetUint("userID"), tokenUuid, refreshUuid, req.Warehouse, amr)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrWarehouseNotAssigned):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrAccountBlocked):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": auth.ErrCodeAccountBlocked})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  tokens.AccessToken,
 		"refresh_token": tokens.RefreshToken,
+		"warehouse":     req.Warehouse,
 	})
 }
 
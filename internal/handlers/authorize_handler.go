@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/auth"
+	"github.com/j94veron/auth-service-insu/internal/authz"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+// AuthorizeHandler answers authorization questions for other services with
+// the same engine that protects this service's routes
+type AuthorizeHandler struct {
+	engine      *authz.Engine
+	authService *auth.Service
+	userRepo    user.Repository
+}
+
+func NewAuthorizeHandler(engine *authz.Engine, authService *auth.Service, userRepo user.Repository) *AuthorizeHandler {
+	return &AuthorizeHandler{
+		engine:      engine,
+		authService: authService,
+		userRepo:    userRepo,
+	}
+}
+
+type AuthorizeCheck struct {
+	Resource   string            `json:"resource" binding:"required,startswith=/"`
+	Action     string            `json:"action" binding:"required"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// AuthorizeRequest identifies the subject by token or user ID and lists the
+// checks; a single check may also be given at the top level
+type AuthorizeRequest struct {
+	Token      string            `json:"token" binding:"required_without=UserID"`
+	UserID     uint              `json:"userId" binding:"required_without=Token"`
+	Resource   string            `json:"resource" binding:"omitempty,startswith=/"`
+	Action     string            `json:"action"`
+	Attributes map[string]string `json:"attributes"`
+	Checks     []AuthorizeCheck  `json:"checks" binding:"max=100,dive"`
+}
+
+type authorizeResult struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	authz.Decision
+}
+
+func (h *AuthorizeHandler) Authorize(c *gin.Context) {
+	var req AuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	checks := req.Checks
+	if req.Resource != "" {
+		checks = append([]AuthorizeCheck{{Resource: req.Resource, Action: req.Action, Attributes: req.Attributes}}, checks...)
+	}
+	if len(checks) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource and action or checks are required"})
+		return
+	}
+
+	subject, reason, ok := h.subject(c, &req)
+	if !ok {
+		return
+	}
+
+	allowed := true
+	results := make([]authorizeResult, 0, len(checks))
+	for _, check := range checks {
+		result := authorizeResult{Resource: check.Resource, Action: strings.ToUpper(check.Action)}
+		if subject == nil {
+			result.Decision = authz.Decision{Reason: reason}
+		} else {
+			decision, err := h.engine.Decide(*subject, check.Resource, result.Action, check.Attributes)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+				return
+			}
+			result.Decision = decision
+		}
+		allowed = allowed && result.Allowed
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"allowed": allowed, "results": results})
+}
+
+// subject resolves who the checks are for. An invalid token is not an error
+// of the caller: every check is denied with the returned reason.
+func (h *AuthorizeHandler) subject(c *gin.Context, req *AuthorizeRequest) (*authz.Subject, string, bool) {
+	if req.Token != "" {
+		claims, err := h.authService.Introspect(req.Token)
+		if err != nil {
+			return nil, "subject token is invalid or revoked", true
+		}
+		if claims.Scope != "" {
+			return nil, "subject token is restricted to " + claims.Scope, true
+		}
+		if claims.Tenant() != c.GetUint("tenantID") {
+			return nil, "subject token belongs to another tenant", true
+		}
+		return &authz.Subject{
+			UserID:  claims.UserID,
+			RoleIDs: claims.RoleIDs(),
+			Caller: user.Caller{
+				CommercialZone: claims.CommercialZone,
+				Warehouse:      claims.Warehouse,
+				OtherWarehouse: claims.OtherWarehouse,
+				Province:       claims.Province,
+			},
+		}, "", true
+	}
+
+	u, err := h.userRepo.ForTenant(c.GetUint("tenantID")).FindByID(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	return &authz.Subject{
+		UserID:  u.ID,
+		RoleIDs: u.EffectiveRoleIDs(time.Now()),
+		Caller: user.Caller{
+			CommercialZone: u.CommercialZone,
+			Warehouse:      u.Warehouse,
+			OtherWarehouse: u.OtherWarehouseCodes(),
+			Province:       u.Province,
+		},
+	}, "", true
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/federation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+// IdentityHandler links local users to accounts of external identity
+// providers, so they can sign in with OIDC, SAML or LDAP without
+// auto-provisioning or implicit linking by email
+type IdentityHandler struct {
+	identityRepo federation.Repository
+	userRepo     user.Repository
+}
+
+func NewIdentityHandler(identityRepo federation.Repository, userRepo user.Repository) *IdentityHandler {
+	return &IdentityHandler{
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+	}
+}
+
+// Provider is the configured OIDC provider name, the SAML provider name or
+// "ldap"; subject is the stable ID the provider asserts (sub, NameID or entry DN)
+type LinkIdentityRequest struct {
+	Provider string `json:"provider" binding:"required,max=100"`
+	Subject  string `json:"subject" binding:"required,max=255"`
+	Email    string `json:"email" binding:"omitempty,email,max=100"`
+}
+
+func (h *IdentityHandler) List(c *gin.Context) {
+	u, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	identities, err := h.identityRepo.ListByUser(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+func (h *IdentityHandler) Link(c *gin.Context) {
+	var req LinkIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.identityRepo.FindBySubject(req.Provider, req.Subject); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "External account is already linked"})
+		return
+	}
+
+	identity := models.FederatedIdentity{
+		UserID:   u.ID,
+		Provider: req.Provider,
+		Subject:  req.Subject,
+		Email:    req.Email,
+	}
+	if err := h.identityRepo.Create(&identity); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"identity": identity})
+}
+
+func (h *IdentityHandler) Unlink(c *gin.Context) {
+	identityID, err := strconv.ParseUint(c.Param("identityId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	u, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	identities, err := h.identityRepo.ListByUser(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linked := false
+	for _, identity := range identities {
+		if identity.ID == uint(identityID) {
+			linked = true
+		}
+	}
+	if !linked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+		return
+	}
+
+	if err := h.identityRepo.Delete(uint(identityID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked successfully"})
+}
+
+// findUser loads the user of the :id parameter within the caller's tenant and
+// data scope, writing the error response when it cannot be reached
+func (h *IdentityHandler) findUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return nil, false
+	}
+
+	u, err := h.userRepo.ForTenant(c.GetUint("tenantID")).WithScope(dataScope(c)).FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return u, true
+}
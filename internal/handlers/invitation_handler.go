@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/invitation"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/role"
+)
+
+type InvitationHandler struct {
+	invitations *invitation.Usecase
+	roleRepo    role.Repository
+}
+
+func NewInvitationHandler(invitations *invitation.Usecase, roleRepo role.Repository) *InvitationHandler {
+	return &InvitationHandler{
+		invitations: invitations,
+		roleRepo:    roleRepo,
+	}
+}
+
+type CreateInvitationRequest struct {
+	Email          string `json:"email" binding:"required,email"`
+	Name           string `json:"name" binding:"required"`
+	LastName       string `json:"lastName" binding:"required"`
+	RoleID         uint   `json:"roleId" binding:"required"`
+	CommercialZone string `json:"commercialZone"`
+	Warehouse      string `json:"warehouse"`
+	Province       string `json:"province"`
+}
+
+func (h *InvitationHandler) Create(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The invitee joins the caller's tenant, so the role must be one of its roles
+	r, err := h.roleRepo.ForTenant(c.GetUint("tenantID")).FindByID(req.RoleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if !checkAssignable(c, []models.Role{*r}) {
+		return
+	}
+
+	// Invitations create pending users, so they follow the same data scope as UserHandler.Create
+	invitee := models.User{
+		CommercialZone: req.CommercialZone,
+		Warehouse:      req.Warehouse,
+		Province:       req.Province,
+	}
+	if !dataScope(c).Allows(&invitee) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is outside your data scope"})
+		return
+	}
+
+	inv, err := h.invitations.ForTenant(c.GetUint("tenantID")).Create(invitation.Invite{
+		Email:          req.Email,
+		Name:           req.Name,
+		LastName:       req.LastName,
+		RoleID:         req.RoleID,
+		CommercialZone: req.CommercialZone,
+		Warehouse:      req.Warehouse,
+		Province:       req.Province,
+	}, c.GetUint("userID"))
+	if err != nil {
+		if errors.Is(err, invitation.ErrEmailInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"invitation": inv})
+}
+
+func (h *InvitationHandler) List(c *gin.Context) {
+	invitations, err := h.invitations.ForTenant(c.GetUint("tenantID")).ListPending()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (h *InvitationHandler) Resend(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	inv, err := h.invitations.ForTenant(c.GetUint("tenantID")).Resend(uint(id))
+	if err != nil {
+		invitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitation": inv})
+}
+
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if err := h.invitations.ForTenant(c.GetUint("tenantID")).Revoke(uint(id)); err != nil {
+		invitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+	UserName string `json:"userName" binding:"omitempty,min=3,max=50,excludes=@"`
+}
+
+// Accept is public: the invitation token is the credential
+func (h *InvitationHandler) Accept(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.invitations.Accept(req.Token, req.Password, req.UserName)
+	if err != nil {
+		if errors.Is(err, invitation.ErrInvalidInvitation) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func invitationError(c *gin.Context, err error) {
+	if errors.Is(err, invitation.ErrInvitationClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/auth"
+)
+
+type MagicLinkHandler struct {
+	magicLinkService *auth.MagicLinkService
+}
+
+func NewMagicLinkHandler(magicLinkService *auth.MagicLinkService) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		magicLinkService: magicLinkService,
+	}
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Request always answers the same way, whether or not the address is registered
+func (h *MagicLinkHandler) Request(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.magicLinkService.Request(req.Email); err != nil {
+		if errors.Is(err, auth.ErrMagicLinkDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address is enabled, a login link has been sent"})
+}
+
+type RedeemMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *MagicLinkHandler) Redeem(c *gin.Context) {
+	var req RedeemMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := h.magicLinkService.Redeem(req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMagicLinkDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrInvalidMagicLink):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrAccountBlocked):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": auth.ErrCodeAccountBlocked})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens, user))
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/auth"
+	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/user"
+)
+
+// MeHandler lets any authenticated user read and update their own profile
+type MeHandler struct {
+	authService *auth.Service
+	userRepo    user.Repository
+	roleRepo    role.Repository
+}
+
+func NewMeHandler(authService *auth.Service, userRepo user.Repository, roleRepo role.Repository) *MeHandler {
+	return &MeHandler{
+		authService: authService,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+	}
+}
+
+// Get returns the caller with the roles and permissions the authorization
+// engine applies to them: every assigned role, the roles of active grants and
+// the roles these inherit from
+func (h *MeHandler) Get(c *gin.Context) {
+	user, err := h.userRepo.FindByID(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	roleRepo := h.roleRepo.ForTenant(user.TenantID)
+	roleIDs, err := roleRepo.WithAncestors(user.EffectiveRoleIDs(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	roles, err := roleRepo.FindByIDs(roleIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	permissions, err := roleRepo.EffectivePermissions(roleIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "roles": roles, "permissions": permissions})
+}
+
+// UpdateMeRequest holds the only profile fields users may change themselves
+type UpdateMeRequest struct {
+	Name     string `json:"name" binding:"omitempty,max=100"`
+	LastName string `json:"lastName" binding:"omitempty,max=100"`
+	UserName string `json:"userName" binding:"omitempty,min=3,max=50,excludes=@"`
+}
+
+func (h *MeHandler) Update(c *gin.Context) {
+	var req UpdateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Updates only the provided fields
+	if req.Name != "" {
+		user.Name = req.Name
+	}
+	if req.LastName != "" {
+		user.LastName = req.LastName
+	}
+	if req.UserName != "" {
+		userName, ok := checkUsernameAvailable(c, h.userRepo, req.UserName, user.ID)
+		if !ok {
+			return
+		}
+		user.UserName = &userName
+	}
+
+	if err := h.userRepo.Update(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+// ChangePassword revokes every session of the caller and returns a new token pair.
+// It also accepts the restricted token issued when a change is required.
+func (h *MeHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.ChangePassword(c.GetUint("userID"), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": auth.ErrCodeInvalidCredentials})
+		case errors.Is(err, auth.ErrPasswordReused), errors.Is(err, auth.ErrPasswordManagedExternally):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/auth"
+)
+
+type OIDCHandler struct {
+	oidcService *auth.OIDCService
+}
+
+func NewOIDCHandler(oidcService *auth.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	url, err := h.oidcService.AuthCodeURL(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, auth.ErrUnknownOIDCProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errParam, "description": c.Query("error_description")})
+		return
+	}
+
+	tokens, user, err := h.oidcService.Callback(c.Param("provider"), c.Query("state"), c.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnknownOIDCProvider):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrInvalidOIDCCallback), errors.Is(err, auth.ErrFederatedUserNotLinked), errors.Is(err, auth.ErrFederatedUserPending):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrAccountBlocked):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": auth.ErrCodeAccountBlocked})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens, user))
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/authz"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/permission"
+)
+
+type PermissionHandler struct {
+	permissionRepo permission.Repository
+}
+
+func NewPermissionHandler(permissionRepo permission.Repository) *PermissionHandler {
+	return &PermissionHandler{
+		permissionRepo: permissionRepo,
+	}
+}
+
+type CreatePermissionRequest struct {
+	Resource    string `json:"resource" binding:"required,max=50,excludesall= /"`
+	Endpoint    string `json:"endpoint" binding:"required,max=100,startswith=/,excludesall= ?#"`
+	Method      string `json:"method" binding:"required,oneof=GET POST PUT PATCH DELETE get post put patch delete *"`
+	Effect      string `json:"effect" binding:"omitempty,oneof=allow deny"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+func (h *PermissionHandler) Create(c *gin.Context) {
+	var req CreatePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permission := models.Permission{
+		Resource:    strings.ToLower(req.Resource),
+		Endpoint:    normalizeEndpoint(req.Endpoint),
+		Method:      strings.ToUpper(req.Method),
+		Effect:      req.Effect,
+		Description: req.Description,
+	}
+	if permission.Effect == "" {
+		permission.Effect = models.PermissionAllow
+	}
+	if !checkValid(c, &permission) || !h.checkUnique(c, &permission) {
+		return
+	}
+
+	if err := h.permissions(c).Create(&permission); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"permission": permission})
+}
+
+func (h *PermissionHandler) GetByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	permission, err := h.permissions(c).FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permission": permission})
+}
+
+func (h *PermissionHandler) List(c *gin.Context) {
+	permissions, err := h.permissions(c).List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+type UpdatePermissionRequest struct {
+	Resource    string `json:"resource" binding:"omitempty,max=50,excludesall= /"`
+	Endpoint    string `json:"endpoint" binding:"omitempty,max=100,startswith=/,excludesall= ?#"`
+	Method      string `json:"method" binding:"omitempty,oneof=GET POST PUT PATCH DELETE get post put patch delete *"`
+	Effect      string `json:"effect" binding:"omitempty,oneof=allow deny"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+func (h *PermissionHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req UpdatePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permission, err := h.permissions(c).FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update only the provided fields
+	if req.Resource != "" {
+		permission.Resource = strings.ToLower(req.Resource)
+	}
+	if req.Endpoint != "" {
+		permission.Endpoint = normalizeEndpoint(req.Endpoint)
+	}
+	if req.Method != "" {
+		permission.Method = strings.ToUpper(req.Method)
+	}
+	if req.Effect != "" {
+		permission.Effect = req.Effect
+	}
+	if req.Description != "" {
+		permission.Description = req.Description
+	}
+
+	if !checkValid(c, permission) || !h.checkUnique(c, permission) {
+		return
+	}
+
+	if err := h.permissions(c).Update(permission); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permission": permission})
+}
+
+func (h *PermissionHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if _, err := h.permissions(c).FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Removing a permission in use would silently take access away from roles
+	roles, err := h.permissions(c).CountRoles(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if roles > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Permission is assigned to roles", "roles": roles})
+		return
+	}
+
+	if err := h.permissions(c).Delete(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission deleted successfully"})
+}
+
+// permissions returns the permission repository limited to the caller's tenant
+func (h *PermissionHandler) permissions(c *gin.Context) permission.Repository {
+	return h.permissionRepo.ForTenant(c.GetUint("tenantID"))
+}
+
+// checkValid writes a bad request response for malformed endpoint patterns
+func checkValid(c *gin.Context, permission *models.Permission) bool {
+	if !authz.ValidPattern(permission.Endpoint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endpoint pattern"})
+		return false
+	}
+	return true
+}
+
+// checkUnique writes a conflict response when another permission has the same
+// resource, endpoint and method
+func (h *PermissionHandler) checkUnique(c *gin.Context, permission *models.Permission) bool {
+	exists, err := h.permissions(c).Exists(permission.Resource, permission.Endpoint, permission.Method, permission.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Permission already exists"})
+		return false
+	}
+	return true
+}
+
+// normalizeEndpoint drops the trailing slash so "/api/users/" matches "/api/users"
+func normalizeEndpoint(endpoint string) string {
+	if len(endpoint) > 1 {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	return endpoint
+}
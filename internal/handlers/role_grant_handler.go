@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/grant"
+	"github.com/j94veron/auth-service-insu/internal/models"
+)
+
+type RoleGrantHandler struct {
+	grants *grant.Usecase
+}
+
+func NewRoleGrantHandler(grants *grant.Usecase) *RoleGrantHandler {
+	return &RoleGrantHandler{
+		grants: grants,
+	}
+}
+
+type CreateRoleGrantRequest struct {
+	UserID     uint       `json:"userId" binding:"required"`
+	RoleID     uint       `json:"roleId" binding:"required"`
+	ValidFrom  *time.Time `json:"validFrom"`
+	ValidUntil *time.Time `json:"validUntil"`
+	Reason     string     `json:"reason" binding:"required,max=255"`
+}
+
+// Create grants a role that needs no approval to another user directly
+func (h *RoleGrantHandler) Create(c *gin.Context) {
+	var req CreateRoleGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window := grant.Window{From: req.ValidFrom, Until: req.ValidUntil}
+	roleGrant, err := h.managed(c).Grant(req.UserID, req.RoleID, window, req.Reason, c.GetUint("userID"))
+	if err != nil {
+		writeGrantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"roleGrant": roleGrant})
+}
+
+type RequestRoleGrantRequest struct {
+	RoleID     uint       `json:"roleId" binding:"required"`
+	ValidFrom  *time.Time `json:"validFrom"`
+	ValidUntil *time.Time `json:"validUntil" binding:"required"`
+	Reason     string     `json:"reason" binding:"required,max=255"`
+}
+
+// Request asks for an elevated role for the caller
+func (h *RoleGrantHandler) Request(c *gin.Context) {
+	var req RequestRoleGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window := grant.Window{From: req.ValidFrom, Until: req.ValidUntil}
+	roleGrant, err := h.grants.ForTenant(c.GetUint("tenantID")).Request(c.GetUint("userID"), req.RoleID, window, req.Reason)
+	if err != nil {
+		writeGrantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"roleGrant": roleGrant})
+}
+
+// ListMine returns the grants and requests of the caller
+func (h *RoleGrantHandler) ListMine(c *gin.Context) {
+	grants, err := h.grants.ForTenant(c.GetUint("tenantID")).List("", c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roleGrants": grants})
+}
+
+func (h *RoleGrantHandler) List(c *gin.Context) {
+	var userID uint64
+	if value := c.Query("userId"); value != "" {
+		var err error
+		userID, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userId format"})
+			return
+		}
+	}
+
+	grants, err := h.managed(c).List(c.Query("status"), uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roleGrants": grants})
+}
+
+func (h *RoleGrantHandler) Approve(c *gin.Context) {
+	h.decide(c, (*grant.Usecase).Approve)
+}
+
+func (h *RoleGrantHandler) Reject(c *gin.Context) {
+	h.decide(c, (*grant.Usecase).Reject)
+}
+
+// Revoke ends a grant and the sessions of its user
+func (h *RoleGrantHandler) Revoke(c *gin.Context) {
+	h.decide(c, (*grant.Usecase).Revoke)
+}
+
+func (h *RoleGrantHandler) decide(c *gin.Context, action func(grants *grant.Usecase, id, actorID uint) (*models.RoleGrant, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	roleGrant, err := action(h.managed(c), uint(id), c.GetUint("userID"))
+	if err != nil {
+		writeGrantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roleGrant": roleGrant})
+}
+
+// managed returns the grants usecase limited to the caller's tenant and to
+// the users inside their data scope, as UserHandler does
+func (h *RoleGrantHandler) managed(c *gin.Context) *grant.Usecase {
+	return h.grants.ForTenant(c.GetUint("tenantID")).WithScope(dataScope(c))
+}
+
+func writeGrantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, grant.ErrInvalidWindow), errors.Is(err, grant.ErrNotRequestable), errors.Is(err, grant.ErrApprovalRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, grant.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, grant.ErrGrantClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	}
+}
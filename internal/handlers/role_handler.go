@@ -1,28 +1,40 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/permission"
+	"github.com/j94veron/auth-service-insu/internal/report"
 	"github.com/j94veron/auth-service-insu/internal/role"
 )
 
 type RoleHandler struct {
-	roleRepo role.Repository
+	roleRepo       role.Repository
+	permissionRepo permission.Repository
+	reportRepo     report.Repository
 }
 
-func NewRoleHandler(roleRepo role.Repository) *RoleHandler {
+func NewRoleHandler(roleRepo role.Repository, permissionRepo permission.Repository, reportRepo report.Repository) *RoleHandler {
 	return &RoleHandler{
-		roleRepo: roleRepo,
+		roleRepo:       roleRepo,
+		permissionRepo: permissionRepo,
+		reportRepo:     reportRepo,
 	}
 }
 
 type CreateRoleRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
-	Permissions []uint `json:"permissions"`
+	Name               string `json:"name" binding:"required"`
+	Description        string `json:"description"`
+	Permissions        []uint `json:"permissions" binding:"dive,min=1"`
+	Reports            []uint `json:"reports" binding:"dive,min=1"`
+	Parents            []uint `json:"parents" binding:"dive,min=1"` // Roles to inherit permissions from
+	PasswordMaxAgeDays int    `json:"passwordMaxAgeDays" binding:"min=0"`
+	RequiresApproval   bool   `json:"requiresApproval"` // Only granted for a window, after approval
+	MaxGrantHours      int    `json:"maxGrantHours" binding:"min=0"`
 }
 
 func (h *RoleHandler) Create(c *gin.Context) {
@@ -32,15 +44,34 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		return
 	}
 
-	role := models.Role{
-		Name:        req.Name,
-		Description: req.Description,
+	permissions, ok := h.findPermissions(c, req.Permissions)
+	if !ok {
+		return
 	}
 
-	// based on the IDs provided in req.Permissions
+	reports, ok := findReports(c, h.reportRepo, req.Reports)
+	if !ok {
+		return
+	}
 
-	if err := h.roleRepo.Create(&role); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	parents, ok := findRoles(c, h.roles(c), req.Parents)
+	if !ok {
+		return
+	}
+
+	role := models.Role{
+		Name:               req.Name,
+		Description:        req.Description,
+		Permissions:        permissions,
+		Reports:            reports,
+		Parents:            parents,
+		PasswordMaxAgeDays: req.PasswordMaxAgeDays,
+		RequiresApproval:   req.RequiresApproval,
+		MaxGrantHours:      req.MaxGrantHours,
+	}
+
+	if err := h.roles(c).Create(&role); err != nil {
+		writeRoleError(c, err)
 		return
 	}
 
@@ -54,7 +85,7 @@ func (h *RoleHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	role, err := h.roleRepo.FindByID(uint(id))
+	role, err := h.roles(c).FindByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -64,7 +95,7 @@ func (h *RoleHandler) GetByID(c *gin.Context) {
 }
 
 func (h *RoleHandler) List(c *gin.Context) {
-	roles, err := h.roleRepo.List()
+	roles, err := h.roles(c).List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -74,9 +105,14 @@ func (h *RoleHandler) List(c *gin.Context) {
 }
 
 type UpdateRoleRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Permissions []uint `json:"permissions"`
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	Permissions        []uint `json:"permissions" binding:"dive,min=1"` // Replaces the role's permissions; omit to keep them
+	Reports            []uint `json:"reports" binding:"dive,min=1"`     // Replaces the role's reports; omit to keep them
+	Parents            []uint `json:"parents" binding:"dive,min=1"`     // Replaces the role's parents; omit to keep them
+	PasswordMaxAgeDays *int   `json:"passwordMaxAgeDays" binding:"omitempty,min=0"`
+	RequiresApproval   *bool  `json:"requiresApproval"`
+	MaxGrantHours      *int   `json:"maxGrantHours" binding:"omitempty,min=0"`
 }
 
 func (h *RoleHandler) Update(c *gin.Context) {
@@ -92,7 +128,7 @@ func (h *RoleHandler) Update(c *gin.Context) {
 		return
 	}
 
-	role, err := h.roleRepo.FindByID(uint(id))
+	role, err := h.roles(c).FindByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -105,11 +141,42 @@ func (h *RoleHandler) Update(c *gin.Context) {
 	if req.Description != "" {
 		role.Description = req.Description
 	}
+	if req.PasswordMaxAgeDays != nil {
+		role.PasswordMaxAgeDays = *req.PasswordMaxAgeDays
+	}
+	if req.RequiresApproval != nil {
+		role.RequiresApproval = *req.RequiresApproval
+	}
+	if req.MaxGrantHours != nil {
+		role.MaxGrantHours = *req.MaxGrantHours
+	}
 
-	// Permissions are updated
+	// Everything is checked before the role, its associations and parents are
+	// saved together
+	if req.Permissions != nil {
+		permissions, ok := h.findPermissions(c, req.Permissions)
+		if !ok {
+			return
+		}
+		role.Permissions = append([]models.Permission{}, permissions...)
+	}
+	if req.Reports != nil {
+		reports, ok := findReports(c, h.reportRepo, req.Reports)
+		if !ok {
+			return
+		}
+		role.Reports = append([]models.Report{}, reports...)
+	}
+	if req.Parents != nil {
+		parents, ok := findRoles(c, h.roles(c), req.Parents)
+		if !ok {
+			return
+		}
+		role.Parents = append([]models.Role{}, parents...)
+	}
 
-	if err := h.roleRepo.Update(role); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.roles(c).Update(role); err != nil {
+		writeRoleError(c, err)
 		return
 	}
 
@@ -123,10 +190,226 @@ func (h *RoleHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.roleRepo.Delete(uint(id)); err != nil {
+	if _, err := h.roles(c).FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.roles(c).Delete(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
 }
+
+type RolePermissionsRequest struct {
+	Permissions []uint `json:"permissions" binding:"required,min=1,dive,min=1"`
+}
+
+// AddPermissions grants the given permissions to the role, keeping the current ones
+func (h *RoleHandler) AddPermissions(c *gin.Context) {
+	h.changePermissions(c, h.roles(c).AddPermissions)
+}
+
+// RemovePermissions revokes the given permissions from the role
+func (h *RoleHandler) RemovePermissions(c *gin.Context) {
+	h.changePermissions(c, h.roles(c).RemovePermissions)
+}
+
+func (h *RoleHandler) changePermissions(c *gin.Context, change func(*models.Role, []models.Permission) error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req RolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.roles(c).FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, ok := h.findPermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	if err := change(role, permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err = h.roles(c).FindByID(role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role})
+}
+
+// roles returns the role repository limited to the caller's tenant
+func (h *RoleHandler) roles(c *gin.Context) role.Repository {
+	return h.roleRepo.ForTenant(c.GetUint("tenantID"))
+}
+
+// permissions returns the permission repository limited to the caller's tenant
+func (h *RoleHandler) permissions(c *gin.Context) permission.Repository {
+	return h.permissionRepo.ForTenant(c.GetUint("tenantID"))
+}
+
+// findPermissions loads the permissions by ID and writes a bad request
+// response listing the IDs that do not exist
+func (h *RoleHandler) findPermissions(c *gin.Context, ids []uint) ([]models.Permission, bool) {
+	permissions, err := h.permissions(c).FindByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	found := make(map[uint]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.ID] = true
+	}
+	missing := []uint{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permissions", "permissions": missing})
+		return nil, false
+	}
+
+	return permissions, true
+}
+
+type DataScopeRuleRequest struct {
+	Attribute string   `json:"attribute" binding:"required,oneof=commercial_zone warehouse province"`
+	Values    []string `json:"values" binding:"required,min=1,dive,required,max=100"`
+}
+
+type SetDataScopesRequest struct {
+	Rules []DataScopeRuleRequest `json:"rules" binding:"dive"`
+}
+
+// SetDataScopes replaces the data scope rules of the role; an empty list removes every restriction
+func (h *RoleHandler) SetDataScopes(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req SetDataScopesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.roles(c).FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	rules := make([]models.DataScopeRule, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		rules = append(rules, models.DataScopeRule{
+			Attribute: rule.Attribute,
+			Values:    rule.Values,
+		})
+	}
+
+	if err := h.roles(c).SetDataScopes(uint(id), rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dataScopes": rules})
+}
+
+// EffectivePermissions lists the permissions of the role including the ones
+// inherited from its ancestors, with the roles that grant each of them
+func (h *RoleHandler) EffectivePermissions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if _, err := h.roles(c).FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, err := h.roles(c).EffectivePermissions([]uint{uint(id)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// writeRoleError writes a conflict response when the parents would create a cycle
+func writeRoleError(c *gin.Context, err error) {
+	if errors.Is(err, role.ErrRoleCycle) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A role cannot inherit from itself or its descendants"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// findRoles loads the roles with the given IDs, writing a bad request
+// response listing the unknown ones
+func findRoles(c *gin.Context, roleRepo role.Repository, ids []uint) ([]models.Role, bool) {
+	roles, err := roleRepo.FindByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	found := make(map[uint]bool, len(roles))
+	for _, r := range roles {
+		found[r.ID] = true
+	}
+	missing := []uint{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown roles", "roles": missing})
+		return nil, false
+	}
+
+	return roles, true
+}
+
+// checkAssignable writes a bad request response when any of the roles
+// requires approval: those are only held through role grants, for a window
+func checkAssignable(c *gin.Context, roles []models.Role) bool {
+	elevated := []uint{}
+	for _, r := range roles {
+		if r.RequiresApproval {
+			elevated = append(elevated, r.ID)
+		}
+	}
+	if len(elevated) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Roles that require approval must be requested through /api/me/role-grants",
+			"roles": elevated,
+		})
+		return false
+	}
+	return true
+}
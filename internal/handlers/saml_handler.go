@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/auth"
+)
+
+type SAMLHandler struct {
+	samlService *auth.SAMLService
+}
+
+func NewSAMLHandler(samlService *auth.SAMLService) *SAMLHandler {
+	return &SAMLHandler{
+		samlService: samlService,
+	}
+}
+
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	metadata, err := h.samlService.Metadata()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login redirects the browser to the IdP with a signed AuthnRequest
+func (h *SAMLHandler) Login(c *gin.Context) {
+	url, err := h.samlService.AuthnRequestURL()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// ACS receives the SAMLResponse posted by the IdP
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	tokens, user, err := h.samlService.ACS(c.Request)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidSAMLResponse) || errors.Is(err, auth.ErrFederatedUserNotLinked) || errors.Is(err, auth.ErrFederatedUserPending) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, auth.ErrAccountBlocked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": auth.ErrCodeAccountBlocked})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens, user))
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/tenant"
+	"github.com/j94veron/auth-service-insu/internal/user"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TenantHandler struct {
+	tenantRepo tenant.Repository
+	userRepo   user.Repository
+}
+
+func NewTenantHandler(tenantRepo tenant.Repository, userRepo user.Repository) *TenantHandler {
+	return &TenantHandler{
+		tenantRepo: tenantRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// TenantAdminRequest is the first user of a new tenant, who gets its ADMIN role
+type TenantAdminRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+	Name     string `json:"name" binding:"required"`
+	LastName string `json:"lastName" binding:"required"`
+}
+
+type CreateTenantRequest struct {
+	Name        string             `json:"name" binding:"required,max=100"`
+	Description string             `json:"description" binding:"max=255"`
+	Admin       TenantAdminRequest `json:"admin" binding:"required"`
+}
+
+func (h *TenantHandler) Create(c *gin.Context) {
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := models.Tenant{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if !h.checkUnique(c, &tenant) {
+		return
+	}
+
+	// Emails identify users at login, so they are unique across tenants
+	if _, err := h.userRepo.FindByEmail(req.Admin.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Admin.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	now := time.Now()
+	admin := models.User{
+		Email:              req.Admin.Email,
+		Password:           string(hashedPassword),
+		Name:               req.Admin.Name,
+		LastName:           req.Admin.LastName,
+		MustChangePassword: true,
+		PasswordChangedAt:  &now,
+	}
+
+	if err := h.tenantRepo.Create(&tenant, &admin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"tenant": tenant, "admin": admin})
+}
+
+func (h *TenantHandler) GetByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	tenant, err := h.tenantRepo.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenant": tenant})
+}
+
+func (h *TenantHandler) List(c *gin.Context) {
+	tenants, err := h.tenantRepo.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+}
+
+type UpdateTenantRequest struct {
+	Name        string `json:"name" binding:"omitempty,max=100"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+func (h *TenantHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req UpdateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant, err := h.tenantRepo.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update only the provided fields
+	if req.Name != "" {
+		tenant.Name = req.Name
+	}
+	if req.Description != "" {
+		tenant.Description = req.Description
+	}
+	if !h.checkUnique(c, tenant) {
+		return
+	}
+
+	if err := h.tenantRepo.Update(tenant); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenant": tenant})
+}
+
+func (h *TenantHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if uint(id) == models.DefaultTenantID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The default tenant cannot be deleted"})
+		return
+	}
+
+	if _, err := h.tenantRepo.FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Users would be left without roles, so they have to be removed first
+	users, err := h.tenantRepo.CountUsers(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if users > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tenant still has users", "users": users})
+		return
+	}
+
+	if err := h.tenantRepo.Delete(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tenant deleted successfully"})
+}
+
+// checkUnique writes a conflict response when another tenant has the same name
+func (h *TenantHandler) checkUnique(c *gin.Context, tenant *models.Tenant) bool {
+	exists, err := h.tenantRepo.NameExists(tenant.Name, tenant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tenant name already exists"})
+		return false
+	}
+	return true
+}
@@ -1,22 +1,37 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/auth"
 	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/report"
+	"github.com/j94veron/auth-service-insu/internal/role"
 	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/internal/warehouse"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserHandler struct {
-	userRepo user.Repository
+	userRepo      user.Repository
+	roleRepo      role.Repository
+	reportRepo    report.Repository
+	warehouseRepo warehouse.Repository
+	authService   *auth.Service
 }
 
-func NewUserHandler(userRepo user.Repository) *UserHandler {
+func NewUserHandler(userRepo user.Repository, roleRepo role.Repository, reportRepo report.Repository, warehouseRepo warehouse.Repository, authService *auth.Service) *UserHandler {
 	return &UserHandler{
-		userRepo: userRepo,
+		userRepo:      userRepo,
+		roleRepo:      roleRepo,
+		reportRepo:    reportRepo,
+		warehouseRepo: warehouseRepo,
+		authService:   authService,
 	}
 }
 
@@ -25,9 +40,15 @@ type CreateUserRequest struct {
 	Password       string `json:"password" binding:"required,min=6"`
 	Name           string `json:"name" binding:"required"`
 	LastName       string `json:"lastName" binding:"required"`
+	UserName       string `json:"userName" binding:"omitempty,min=3,max=50,excludes=@"`
 	CommercialZone string `json:"commercialZone"`
 	Warehouse      string `json:"warehouse"`
 	RoleID         uint   `json:"roleId" binding:"required"`
+	RoleIDs        []uint `json:"roleIds" binding:"dive,min=1"`      // Additional roles
+	ReportIDs      []uint `json:"reportIds" binding:"dive,min=1"`    // Reports besides the ones of the roles
+	WarehouseIDs   []uint `json:"warehouseIds" binding:"dive,min=1"` // Sites besides warehouse
+	// The password set by the admin is temporary unless this is false
+	MustChangePassword *bool `json:"mustChangePassword"`
 }
 
 func (h *UserHandler) Create(c *gin.Context) {
@@ -44,17 +65,52 @@ func (h *UserHandler) Create(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
 	user := models.User{
-		Email:          req.Email,
-		Password:       string(hashedPassword),
-		Name:           req.Name,
-		LastName:       req.LastName,
-		CommercialZone: req.CommercialZone,
-		Warehouse:      req.Warehouse,
-		RoleID:         req.RoleID,
+		Email:              req.Email,
+		Password:           string(hashedPassword),
+		Name:               req.Name,
+		LastName:           req.LastName,
+		CommercialZone:     req.CommercialZone,
+		Warehouse:          req.Warehouse,
+		RoleID:             req.RoleID,
+		MustChangePassword: req.MustChangePassword == nil || *req.MustChangePassword,
+		PasswordChangedAt:  &now,
 	}
 
-	if err := h.userRepo.Create(&user); err != nil {
+	// The primary role is looked up too, so it must belong to the caller's tenant
+	roles, ok := findRoles(c, h.roles(c), append([]uint{req.RoleID}, req.RoleIDs...))
+	if !ok || !checkAssignable(c, roles) {
+		return
+	}
+	user.Roles = roles
+
+	reports, ok := findReports(c, h.reportRepo, req.ReportIDs)
+	if !ok {
+		return
+	}
+	user.Reports = reports
+
+	warehouses, ok := findWarehouses(c, h.warehouseRepo, req.WarehouseIDs)
+	if !ok {
+		return
+	}
+	user.Warehouses = warehouses
+
+	if req.UserName != "" {
+		userName, ok := checkUsernameAvailable(c, h.userRepo, req.UserName, 0)
+		if !ok {
+			return
+		}
+		user.UserName = &userName
+	}
+
+	if !dataScope(c).Allows(&user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is outside your data scope"})
+		return
+	}
+
+	if err := h.users(c).Create(&user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -69,7 +125,7 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.FindByID(uint(id))
+	user, err := h.users(c).FindByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -79,7 +135,7 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 }
 
 func (h *UserHandler) List(c *gin.Context) {
-	users, err := h.userRepo.List()
+	users, err := h.users(c).List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -91,10 +147,16 @@ func (h *UserHandler) List(c *gin.Context) {
 type UpdateUserRequest struct {
 	Name           string `json:"name"`
 	LastName       string `json:"lastName"`
+	UserName       string `json:"userName" binding:"omitempty,min=3,max=50,excludes=@"`
 	CommercialZone string `json:"commercialZone"`
 	Warehouse      string `json:"warehouse"`
 	RoleID         uint   `json:"roleId"`
+	RoleIDs        []uint `json:"roleIds" binding:"dive,min=1"`      // Replaces the additional roles; omit to keep them
+	ReportIDs      []uint `json:"reportIds" binding:"dive,min=1"`    // Replaces the user's own reports; omit to keep them
+	WarehouseIDs   []uint `json:"warehouseIds" binding:"dive,min=1"` // Replaces the additional sites; omit to keep them
 	Password       string `json:"password"`
+	// Forces a password change at next login; a new password is temporary unless this is false
+	MustChangePassword *bool `json:"mustChangePassword"`
 }
 
 func (h *UserHandler) Update(c *gin.Context) {
@@ -110,7 +172,8 @@ func (h *UserHandler) Update(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.FindByID(uint(id))
+	userRepo := h.users(c)
+	user, err := userRepo.FindByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -123,14 +186,57 @@ func (h *UserHandler) Update(c *gin.Context) {
 	if req.LastName != "" {
 		user.LastName = req.LastName
 	}
+	if req.UserName != "" {
+		userName, ok := checkUsernameAvailable(c, h.userRepo, req.UserName, user.ID)
+		if !ok {
+			return
+		}
+		user.UserName = &userName
+	}
 	if req.CommercialZone != "" {
 		user.CommercialZone = req.CommercialZone
 	}
 	if req.Warehouse != "" {
 		user.Warehouse = req.Warehouse
 	}
-	if req.RoleID != 0 {
+	if req.RoleID != 0 && req.RoleID != user.RoleID {
+		primary, ok := findRoles(c, h.roles(c), []uint{req.RoleID})
+		if !ok || !checkAssignable(c, primary) {
+			return
+		}
+		// The previous primary role is dropped unless listed in roleIds
+		roles := user.Roles[:0]
+		for _, r := range user.Roles {
+			if r.ID != user.RoleID {
+				roles = append(roles, r)
+			}
+		}
+		user.Roles = roles
 		user.RoleID = req.RoleID
+		user.Role = models.Role{}
+	}
+	if req.RoleIDs != nil {
+		roles, ok := findRoles(c, h.roles(c), req.RoleIDs)
+		if !ok || !checkAssignable(c, roles) {
+			return
+		}
+		user.Roles = roles
+	}
+	if req.ReportIDs != nil {
+		reports, ok := findReports(c, h.reportRepo, req.ReportIDs)
+		if !ok {
+			return
+		}
+		// Never nil, so that an empty list clears the reports
+		user.Reports = append([]models.Report{}, reports...)
+	}
+	if req.WarehouseIDs != nil {
+		warehouses, ok := findWarehouses(c, h.warehouseRepo, req.WarehouseIDs)
+		if !ok {
+			return
+		}
+		// Never nil, so that an empty list clears the warehouses
+		user.Warehouses = append([]models.Warehouse{}, warehouses...)
 	}
 	if req.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -138,10 +244,20 @@ func (h *UserHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
 			return
 		}
+		now := time.Now()
 		user.Password = string(hashedPassword)
+		user.PasswordChangedAt = &now
+		user.MustChangePassword = true
+	}
+	if req.MustChangePassword != nil {
+		user.MustChangePassword = *req.MustChangePassword
 	}
 
-	if err := h.userRepo.Update(user); err != nil {
+	if err := userRepo.Update(user); err != nil {
+		if outOfScope(err) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is outside your data scope"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -156,10 +272,172 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.userRepo.Delete(uint(id)); err != nil {
+	if err := h.users(c).Delete(uint(id)); err != nil {
+		if outOfScope(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+type SuspendUserRequest struct {
+	Status string     `json:"status" binding:"omitempty,oneof=suspended locked disabled"`
+	Reason string     `json:"reason" binding:"required,max=255"`
+	From   *time.Time `json:"from"`  // Defaults to now
+	Until  *time.Time `json:"until"` // Empty keeps the user blocked until reactivated
+}
+
+// Suspend blocks the user. When the block starts now, every session of the
+// user is revoked at once.
+func (h *UserHandler) Suspend(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	if req.From == nil {
+		req.From = &now
+	}
+	if req.Until != nil && !req.Until.After(*req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until must be after from"})
+		return
+	}
+	if req.Status == "" {
+		req.Status = models.UserStatusSuspended
+	}
+
+	actorID := c.GetUint("userID")
+	if actorID == uint(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot suspend yourself"})
+		return
+	}
+
+	userRepo := h.users(c)
+	target, err := userRepo.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if target.Status == models.UserStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has not accepted the invitation yet"})
+		return
+	}
+
+	target.Status = req.Status
+	target.StatusReason = req.Reason
+	target.StatusChangedBy = &actorID
+	target.StatusFrom = req.From
+	target.StatusUntil = req.Until
+
+	if err := userRepo.Update(target); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Blocks scheduled for later are enforced by AuthRequired once they start
+	if target.Blocked(now) {
+		if err := h.authService.RevokeSessions(target.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User suspended but sessions could not be revoked"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": target})
+}
+
+type ReactivateUserRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// Reactivate lifts any suspension, lock or disable of the user
+func (h *UserHandler) Reactivate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req ReactivateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userRepo := h.users(c)
+	target, err := userRepo.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if target.Status == models.UserStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has not accepted the invitation yet"})
+		return
+	}
+
+	now := time.Now()
+	actorID := c.GetUint("userID")
+	target.Status = models.UserStatusActive
+	target.StatusReason = req.Reason
+	target.StatusChangedBy = &actorID
+	target.StatusFrom = &now
+	target.StatusUntil = nil
+
+	if err := userRepo.Update(target); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": target})
+}
+
+// checkUsernameAvailable normalizes the username and writes a conflict response
+// when it is already taken by a user other than excludeID
+func checkUsernameAvailable(c *gin.Context, userRepo user.Repository, userName string, excludeID uint) (string, bool) {
+	userName = user.NormalizeUsername(userName)
+
+	exists, err := userRepo.UsernameExists(userName, excludeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already in use"})
+		return "", false
+	}
+
+	return userName, true
+}
+
+// roles returns the role repository limited to the caller's tenant
+func (h *UserHandler) roles(c *gin.Context) role.Repository {
+	return h.roleRepo.ForTenant(c.GetUint("tenantID"))
+}
+
+// users returns the user repository limited to the caller's tenant and data scope
+func (h *UserHandler) users(c *gin.Context) user.Repository {
+	return h.userRepo.ForTenant(c.GetUint("tenantID")).WithScope(dataScope(c))
+}
+
+// dataScope returns the data scope set by PermissionMiddleware, nil when unrestricted
+func dataScope(c *gin.Context) *user.Scope {
+	if scope, ok := c.Get("dataScope"); ok {
+		return scope.(*user.Scope)
+	}
+	return nil
+}
+
+func outOfScope(err error) bool {
+	return errors.Is(err, user.ErrOutOfScope)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/warehouse"
+)
+
+type WarehouseHandler struct {
+	warehouseRepo warehouse.Repository
+}
+
+func NewWarehouseHandler(warehouseRepo warehouse.Repository) *WarehouseHandler {
+	return &WarehouseHandler{
+		warehouseRepo: warehouseRepo,
+	}
+}
+
+// Codes end up in the comma-separated other_warehouse claim
+type CreateWarehouseRequest struct {
+	Code string `json:"code" binding:"required,max=100,excludesall=0x2C"`
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+func (h *WarehouseHandler) Create(c *gin.Context) {
+	var req CreateWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warehouse := models.Warehouse{
+		Code: req.Code,
+		Name: req.Name,
+	}
+	if !h.checkUnique(c, &warehouse) {
+		return
+	}
+
+	if err := h.warehouseRepo.Create(&warehouse); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"warehouse": warehouse})
+}
+
+func (h *WarehouseHandler) GetByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	warehouse, err := h.warehouseRepo.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"warehouse": warehouse})
+}
+
+func (h *WarehouseHandler) List(c *gin.Context) {
+	warehouses, err := h.warehouseRepo.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"warehouses": warehouses})
+}
+
+// Users keep the code in their warehouse field, so codes cannot be renamed
+type UpdateWarehouseRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+func (h *WarehouseHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req UpdateWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warehouse, err := h.warehouseRepo.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	warehouse.Name = req.Name
+
+	if err := h.warehouseRepo.Update(warehouse); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"warehouse": warehouse})
+}
+
+func (h *WarehouseHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if _, err := h.warehouseRepo.FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, err := h.warehouseRepo.CountUsers(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if users > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Warehouse is assigned to users", "users": users})
+		return
+	}
+
+	if err := h.warehouseRepo.Delete(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Warehouse deleted successfully"})
+}
+
+// checkUnique writes a conflict response when another warehouse has the same code
+func (h *WarehouseHandler) checkUnique(c *gin.Context, warehouse *models.Warehouse) bool {
+	exists, err := h.warehouseRepo.CodeExists(warehouse.Code, warehouse.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Warehouse code already exists"})
+		return false
+	}
+	return true
+}
+
+// findWarehouses loads the warehouses with the given IDs, writing a bad
+// request response listing the unknown ones
+func findWarehouses(c *gin.Context, warehouseRepo warehouse.Repository, ids []uint) ([]models.Warehouse, bool) {
+	warehouses, err := warehouseRepo.FindByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	found := make(map[uint]bool, len(warehouses))
+	for _, w := range warehouses {
+		found[w.ID] = true
+	}
+	missing := []uint{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown warehouses", "warehouses": missing})
+		return nil, false
+	}
+
+	return warehouses, true
+}
@@ -0,0 +1,92 @@
+package invitation
+
+import (
+	"errors"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindByID(id uint) (*models.Invitation, error)
+	FindByTokenHash(tokenHash string) (*models.Invitation, error)
+	Create(invitation *models.Invitation) error
+	Update(invitation *models.Invitation) error
+	ListPending() ([]models.Invitation, error)
+	RevokePendingForUser(userID uint, at time.Time) error
+
+	// ForTenant returns a repository whose FindByID and ListPending only reach
+	// invitations of users of the tenant
+	ForTenant(tenantID uint) Repository
+}
+
+type repository struct {
+	db       *gorm.DB
+	tenantID uint // 0 reaches every tenant
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ForTenant(tenantID uint) Repository {
+	return &repository{db: r.db, tenantID: tenantID}
+}
+
+// query starts an invitations query limited to users of the tenant
+func (r *repository) query() *gorm.DB {
+	if r.tenantID == 0 {
+		return r.db
+	}
+	return r.db.Where("invitations.user_id IN (SELECT id FROM users WHERE tenant_id = ?)", r.tenantID)
+}
+
+func (r *repository) FindByID(id uint) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := r.query().Preload("User.Role").First(&invitation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *repository) FindByTokenHash(tokenHash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := r.db.Preload("User").Where("token_hash = ?", tokenHash).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *repository) Create(invitation *models.Invitation) error {
+	return r.db.Omit("User").Create(invitation).Error
+}
+
+func (r *repository) Update(invitation *models.Invitation) error {
+	return r.db.Omit("User").Save(invitation).Error
+}
+
+// ListPending returns the invitations not accepted nor revoked, including expired ones so they can be resent
+func (r *repository) ListPending() ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := r.query().Preload("User.Role").
+		Where("accepted_at IS NULL AND revoked_at IS NULL").
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *repository) RevokePendingForUser(userID uint, at time.Time) error {
+	return r.db.Model(&models.Invitation{}).
+		Where("user_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
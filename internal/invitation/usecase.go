@@ -0,0 +1,256 @@
+package invitation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"github.com/j94veron/auth-service-insu/internal/user"
+	"github.com/j94veron/auth-service-insu/pkg/mailer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrEmailInUse is returned when inviting an address that already has an active account
+var ErrEmailInUse = errors.New("email already in use")
+
+// ErrInvalidInvitation is returned for unknown, expired, revoked or already accepted invitations
+var ErrInvalidInvitation = errors.New("invitación inválida o expirada")
+
+// ErrInvitationClosed is returned when resending or revoking an accepted or revoked invitation
+var ErrInvitationClosed = errors.New("invitation already accepted or revoked")
+
+// Config configures invitation links
+type Config struct {
+	TTL     time.Duration // Lifetime of an invitation link
+	LinkURL string        // Frontend URL the token is appended to (ej: "https://app/invitation?token=")
+}
+
+// Invite describes the pending user created by an admin
+type Invite struct {
+	Email          string
+	Name           string
+	LastName       string
+	RoleID         uint
+	CommercialZone string
+	Warehouse      string
+	Province       string
+}
+
+type Usecase struct {
+	repo     Repository
+	userRepo user.Repository
+	mailer   mailer.Mailer
+	config   Config
+	tenantID uint // 0 reaches every tenant
+}
+
+func NewUsecase(repo Repository, userRepo user.Repository, mailer mailer.Mailer, config Config) *Usecase {
+	return &Usecase{
+		repo:     repo,
+		userRepo: userRepo,
+		mailer:   mailer,
+		config:   config,
+	}
+}
+
+// ForTenant returns a usecase that invites users into the tenant and only
+// reaches its invitations
+func (u *Usecase) ForTenant(tenantID uint) *Usecase {
+	return &Usecase{
+		repo:     u.repo.ForTenant(tenantID),
+		userRepo: u.userRepo.ForTenant(tenantID),
+		mailer:   u.mailer,
+		config:   u.config,
+		tenantID: tenantID,
+	}
+}
+
+// Create adds a pending user and emails them an invitation. Inviting again an
+// address that is still pending replaces its previous invitation.
+func (u *Usecase) Create(invite Invite, invitedBy uint) (*models.Invitation, error) {
+	pending, err := u.userRepo.FindByEmail(invite.Email)
+	if err == nil && pending.Status != models.UserStatusPending {
+		return nil, ErrEmailInUse
+	}
+	// Emails are unique across tenants; a pending user of another tenant is not ours to reinvite
+	if err == nil && u.tenantID != 0 && pending.TenantID != u.tenantID {
+		return nil, ErrEmailInUse
+	}
+	if err != nil {
+		pending = &models.User{
+			Email: invite.Email,
+			// Pending users cannot log in until they accept the invitation
+			Password: "!",
+			Status:   models.UserStatusPending,
+		}
+	}
+
+	pending.Name = invite.Name
+	pending.LastName = invite.LastName
+	pending.RoleID = invite.RoleID
+	pending.Role = models.Role{}
+	pending.Roles = nil
+	pending.CommercialZone = invite.CommercialZone
+	pending.Warehouse = invite.Warehouse
+	pending.Province = invite.Province
+
+	if pending.ID == 0 {
+		err = u.userRepo.Create(pending)
+	} else {
+		err = u.userRepo.Update(pending)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := u.repo.RevokePendingForUser(pending.ID, now); err != nil {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		UserID:    pending.ID,
+		InvitedBy: invitedBy,
+	}
+	plainToken, err := u.renew(invitation, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.Create(invitation); err != nil {
+		return nil, err
+	}
+
+	if err := u.send(pending, plainToken); err != nil {
+		return nil, err
+	}
+
+	return u.repo.FindByID(invitation.ID)
+}
+
+// Resend issues a new link for a pending invitation; the previous link stops working
+func (u *Usecase) Resend(id uint) (*models.Invitation, error) {
+	invitation, err := u.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return nil, ErrInvitationClosed
+	}
+
+	plainToken, err := u.renew(invitation, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.Update(invitation); err != nil {
+		return nil, err
+	}
+
+	if err := u.send(&invitation.User, plainToken); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// Revoke cancels a pending invitation. The user stays pending and can be invited again.
+func (u *Usecase) Revoke(id uint) error {
+	invitation, err := u.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return ErrInvitationClosed
+	}
+
+	now := time.Now()
+	invitation.RevokedAt = &now
+	return u.repo.Update(invitation)
+}
+
+func (u *Usecase) ListPending() ([]models.Invitation, error) {
+	return u.repo.ListPending()
+}
+
+// Accept sets the invitee's password and activates the account. Each link can be used once.
+func (u *Usecase) Accept(plainToken, password, userName string) (*models.User, error) {
+	invitation, err := u.repo.FindByTokenHash(hashToken(plainToken))
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	now := time.Now()
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil || now.After(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitee, err := u.userRepo.FindByID(invitation.UserID)
+	if err != nil || invitee.Status != models.UserStatusPending {
+		return nil, ErrInvalidInvitation
+	}
+
+	if userName != "" {
+		userName = user.NormalizeUsername(userName)
+		exists, err := u.userRepo.UsernameExists(userName, invitee.ID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errors.New("username already in use")
+		}
+		invitee.UserName = &userName
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	invitee.Password = string(hashedPassword)
+	invitee.PasswordChangedAt = &now
+	invitee.MustChangePassword = false
+	invitee.Status = models.UserStatusActive
+	if err := u.userRepo.Update(invitee); err != nil {
+		return nil, err
+	}
+
+	invitation.AcceptedAt = &now
+	if err := u.repo.Update(invitation); err != nil {
+		return nil, err
+	}
+
+	return invitee, nil
+}
+
+// renew gives the invitation a new token and expiry and returns the plain token
+func (u *Usecase) renew(invitation *models.Invitation, now time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plainToken := base64.RawURLEncoding.EncodeToString(b)
+
+	invitation.TokenHash = hashToken(plainToken)
+	invitation.ExpiresAt = now.Add(u.config.TTL)
+	invitation.SentAt = now
+
+	return plainToken, nil
+}
+
+func (u *Usecase) send(invitee *models.User, plainToken string) error {
+	body := "Hola " + invitee.Name + ",\n\n" +
+		"Fuiste invitado a crear tu cuenta. Usá el siguiente enlace para elegir tu contraseña. " +
+		"Vence en " + strconv.Itoa(int(u.config.TTL.Hours())) + " horas y solo puede usarse una vez:\n\n" +
+		u.config.LinkURL + plainToken + "\n"
+
+	return u.mailer.Send(invitee.Email, "Invitación para crear tu cuenta", body)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
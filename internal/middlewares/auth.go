@@ -4,8 +4,11 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/apikey"
+	"github.com/j94veron/auth-service-insu/internal/authz"
 	"github.com/j94veron/auth-service-insu/pkg/redis"
 	"github.com/j94veron/auth-service-insu/pkg/token"
 )
@@ -13,16 +16,22 @@ import (
 type AuthMiddleware struct {
 	tokenService *token.TokenService
 	redisClient  *redis.Client
+	apiKeys      *apikey.Usecase
+	engine       *authz.Engine
 }
 
-func NewAuthMiddleware(tokenService *token.TokenService, redisClient *redis.Client) *AuthMiddleware {
+func NewAuthMiddleware(tokenService *token.TokenService, redisClient *redis.Client, apiKeys *apikey.Usecase, engine *authz.Engine) *AuthMiddleware {
 	return &AuthMiddleware{
 		tokenService: tokenService,
 		redisClient:  redisClient,
+		apiKeys:      apiKeys,
+		engine:       engine,
 	}
 }
 
-func (am *AuthMiddleware) AuthRequired() gin.HandlerFunc {
+// AuthRequired validates the bearer token or API key. Restricted tokens (with a
+// scope) are only accepted on routes that list their scope in allowedScopes.
+func (am *AuthMiddleware) AuthRequired(allowedScopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -31,9 +40,14 @@ func (am *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(authHeader, "ApiKey ") {
+			am.apiKeyAuth(c, strings.TrimPrefix(authHeader, "ApiKey "))
+			return
+		}
+
 		parts := strings.Split(authHeader, "Bearer ")
 		if len(parts) != 2 {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token} or ApiKey {key}"})
 			c.Abort()
 			return
 		}
@@ -46,6 +60,12 @@ func (am *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		if claims.Scope != "" && !scopeAllowed(allowedScopes, claims.Scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "code": "PASSWORD_CHANGE_REQUIRED"})
+			c.Abort()
+			return
+		}
+
 		// Check if the token is in Redis/blacklist
 		ctx := context.Background()
 		userID, err := am.redisClient.GetUserID(ctx, claims.TokenUuid)
@@ -62,15 +82,68 @@ func (am *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		// Suspensions may start after the token was issued
+		restricted, err := am.engine.Restricted(claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking account status"})
+			c.Abort()
+			return
+		}
+		if restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has restrictions"})
+			c.Abort()
+			return
+		}
+
 		// token al contexto para usar en los handlers
 		c.Set("userID", claims.UserID)
+		c.Set("tenantID", claims.Tenant())
 		c.Set("userName", claims.Name)
 		c.Set("userLastName", claims.LastName)
 		c.Set("commercialZone", claims.CommercialZone)
 		c.Set("warehouse", claims.Warehouse)
+		c.Set("otherWarehouse", claims.OtherWarehouse)
+		c.Set("province", claims.Province)
 		c.Set("roleID", claims.RoleID)
+		c.Set("roleIDs", claims.RoleIDs())
 		c.Set("tokenUuid", claims.TokenUuid)
+		c.Set("refreshUuid", claims.RefreshUuid)
+		c.Set("amr", claims.Amr)
 
 		c.Next()
 	}
 }
+
+func scopeAllowed(allowedScopes []string, scope string) bool {
+	for _, allowed := range allowedScopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyAuth authenticates machine users and sets the same context values as a token
+func (am *AuthMiddleware) apiKeyAuth(c *gin.Context, plainKey string) {
+	key, owner, err := am.apiKeys.Authenticate(plainKey)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", owner.ID)
+	c.Set("tenantID", owner.TenantID)
+	c.Set("userName", owner.Name)
+	c.Set("userLastName", owner.LastName)
+	c.Set("commercialZone", owner.CommercialZone)
+	c.Set("warehouse", owner.Warehouse)
+	c.Set("otherWarehouse", owner.OtherWarehouseCodes())
+	c.Set("province", owner.Province)
+	c.Set("roleID", owner.RoleID)
+	c.Set("roleIDs", owner.EffectiveRoleIDs(time.Now()))
+	c.Set("apiKeyID", key.ID)
+	c.Set("apiKeyScopes", key.Scopes)
+
+	c.Next()
+}
@@ -4,26 +4,26 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/j94veron/auth-service-insu/internal/role"
+	"github.com/j94veron/auth-service-insu/internal/authz"
 	"github.com/j94veron/auth-service-insu/internal/user"
 )
 
 type PermissionMiddleware struct {
-	userRepo     user.Repository
-	roleRepo     role.Repository
-	allowedRoles []string
+	engine *authz.Engine
 }
 
-func NewPermissionMiddleware(userRepo user.Repository, roleRepo role.Repository) *PermissionMiddleware {
+func NewPermissionMiddleware(engine *authz.Engine) *PermissionMiddleware {
 	return &PermissionMiddleware{
-		userRepo:     userRepo,
-		roleRepo:     roleRepo,
-		allowedRoles: []string{"USER_ROLE_SCAN", "ADMIN"},
+		engine: engine,
 	}
 }
 
-func (pm *PermissionMiddleware) HasPermission(endpoint string) gin.HandlerFunc {
+// HasPermission only lets the request through when the permissions of the
+// user's roles, taken together, allow the route and the HTTP method
+func (pm *PermissionMiddleware) HasPermission() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		route := c.FullPath()
+
 		userID, exists := c.Get("userID")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -31,37 +31,70 @@ func (pm *PermissionMiddleware) HasPermission(endpoint string) gin.HandlerFunc {
 			return
 		}
 
-		roleID, exists := c.Get("roleID")
+		roleIDs, exists := c.Get("roleIDs")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Role information missing"})
 			c.Abort()
 			return
 		}
 
-		// Check if the role matches the allowed roles
-		roleName, err := pm.roleRepo.GetRoleName(roleID.(uint))
-		if err != nil || !pm.roleIsAllowed(roleName) {
+		subject := authz.Subject{
+			UserID:  userID.(uint),
+			RoleIDs: roleIDs.([]uint),
+			Caller: user.Caller{
+				CommercialZone: c.GetString("commercialZone"),
+				Warehouse:      c.GetString("warehouse"),
+				OtherWarehouse: c.GetString("otherWarehouse"),
+				Province:       c.GetString("province"),
+			},
+		}
+
+		// Check the roles' permissions for the endpoint and method
+		decision, err := pm.engine.Decide(subject, route, c.Request.Method, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+			c.Abort()
+			return
+		}
+		if decision.Reason == authz.ReasonRestricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has restrictions"})
+			c.Abort()
+			return
+		}
+		if !decision.Allowed {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to access this resource."})
 			c.Abort()
 			return
 		}
 
-		// Check if the user has any specific restrictions
-		userRestricted, err := pm.userRepo.IsUserRestricted(userID.(uint))
-		if err != nil || userRestricted {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has restrictions"})
+		// API keys can be limited to some endpoints
+		if scopes, ok := c.Get("apiKeyScopes"); ok && !scopeAllows(scopes.([]string), route) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is not allowed to access this resource"})
+			c.Abort()
+			return
+		}
+
+		// Data scope rules of the roles limit which users the caller can reach
+		scope, err := pm.engine.Scope(subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
 			c.Abort()
 			return
 		}
+		c.Set("dataScope", scope)
 
 		c.Next()
 	}
 }
 
-// roleIsAllowed checks if the given role is in the list of allowed roles
-func (pm *PermissionMiddleware) roleIsAllowed(roleName string) bool {
-	for _, allowedRole := range pm.allowedRoles {
-		if allowedRole == roleName {
+// scopeAllows matches the route against the endpoint patterns an API key is
+// limited to; no scopes means no limit
+func scopeAllows(scopes []string, route string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if authz.Match(scope, route) {
 			return true
 		}
 	}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/j94veron/auth-service-insu/internal/models"
+)
+
+// SuperAdminRequired only lets callers of the default tenant through. Tenants
+// manage their own roles and permissions, so a permission alone must not open
+// routes that reach every tenant.
+func SuperAdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("tenantID") != models.DefaultTenantID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the default tenant can manage this resource"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// APIKey lets machine users and integrations authenticate as their owner.
+// Only a hash of the secret part is stored.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:20;not null;uniqueIndex"` // Public part of the key, used to look it up
+	SecretHash string     `json:"-" gorm:"size:64;not null"`                  // SHA-256 of the secret part
+	UserID     uint       `json:"userId" gorm:"not null;index"`               // Owner, whose role applies to the key
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`              // Endpoints allowed (ej: "/api/users"); empty allows all of the owner's
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedBy  uint       `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
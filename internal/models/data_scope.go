@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// DataScopeRule limits the users a role can see and edit to those whose
+// attribute is one of Values. Values may reference the caller's own
+// attributes with placeholders such as "$commercialZone".
+type DataScopeRule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RoleID    uint      `json:"roleId" gorm:"not null;index"`
+	Attribute string    `json:"attribute" gorm:"size:30;not null"`
+	Values    []string  `json:"values" gorm:"serializer:json"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// User attributes a data scope rule can restrict
+const (
+	ScopeAttributeCommercialZone = "commercial_zone"
+	ScopeAttributeWarehouse      = "warehouse"
+	ScopeAttributeProvince       = "province"
+)
+
+// Placeholders resolved from the caller's claims
+const (
+	ScopeValueCommercialZone = "$commercialZone"
+	ScopeValueWarehouse      = "$warehouse"
+	ScopeValueOtherWarehouse = "$otherWarehouse"
+	ScopeValueProvince       = "$province"
+)
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// KnownDevice is a device a user has successfully logged in from
+type KnownDevice struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"userId" gorm:"not null;uniqueIndex:idx_user_fingerprint"`
+	Fingerprint string    `json:"-" gorm:"size:64;not null;uniqueIndex:idx_user_fingerprint"` // SHA-256 of the device ID or user agent
+	DeviceID    string    `json:"deviceId" gorm:"size:255"`
+	UserAgent   string    `json:"userAgent" gorm:"size:512"`
+	LastIP      string    `json:"lastIp" gorm:"size:45"`
+	LastCountry string    `json:"lastCountry" gorm:"size:2"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// LoginEvent records where each successful login came from
+type LoginEvent struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	UserID           uint      `json:"userId" gorm:"not null;index"`
+	IP               string    `json:"ip" gorm:"size:45"`
+	UserAgent        string    `json:"userAgent" gorm:"size:512"`
+	DeviceID         string    `json:"deviceId" gorm:"size:255"`
+	Country          string    `json:"country" gorm:"size:2"` // ISO code, empty when unknown
+	Latitude         float64   `json:"latitude"`
+	Longitude        float64   `json:"longitude"`
+	HasLocation      bool      `json:"hasLocation"`
+	NewDevice        bool      `json:"newDevice"`
+	UnusualCountry   bool      `json:"unusualCountry"`
+	ImpossibleTravel bool      `json:"impossibleTravel"`
+	StepUp           bool      `json:"stepUp"`         // The login was held for step-up MFA
+	StepUpVerified   bool      `json:"stepUpVerified"` // The step-up code was entered; older held logins may never have been completed
+	CreatedAt        time.Time `json:"createdAt"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// FederatedIdentity links a user to an account of an external identity provider
+type FederatedIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"size:100;not null;uniqueIndex:idx_provider_subject"` // Provider name (ej: "partner-a")
+	Subject   string    `json:"subject" gorm:"size:255;not null;uniqueIndex:idx_provider_subject"`  // Stable ID of the user at the provider
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
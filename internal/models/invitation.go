@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Invitation lets a pending user set their own password and activate the account
+type Invitation struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"userId" gorm:"not null;index"`
+	User       User       `json:"user"`
+	TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"` // SHA-256 of the token sent by email
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	SentAt     time.Time  `json:"sentAt"`
+	AcceptedAt *time.Time `json:"acceptedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	InvitedBy  uint       `json:"invitedBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
@@ -2,11 +2,19 @@ package models
 
 import "time"
 
+// Permission effects; a deny overrides less specific allows
+const (
+	PermissionAllow = "allow"
+	PermissionDeny  = "deny"
+)
+
 type Permission struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
-	Resource    string    `json:"resource"` // Resource name (ej: "users")
-	Endpoint    string    `json:"endpoint"` // specific endpoint (ej: "/api/users")
-	Method      string    `json:"method"`   // Method HTTP (GET, POST, etc.)
+	TenantID    uint      `json:"tenantId" gorm:"not null;default:1;uniqueIndex:unique_permission"`
+	Resource    string    `json:"resource" gorm:"size:50;uniqueIndex:unique_permission"`  // Resource name (ej: "users")
+	Endpoint    string    `json:"endpoint" gorm:"size:100;uniqueIndex:unique_permission"` // Route pattern (ej: "/api/users/:id", "/api/users/*")
+	Method      string    `json:"method" gorm:"size:10;uniqueIndex:unique_permission"`    // Method HTTP (GET, POST, etc.) or * for any
+	Effect      string    `json:"effect" gorm:"size:5;default:allow"`
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Report is an entry of the reports catalogue. Users are entitled to the
+// reports assigned to them and to the ones of their roles.
+type Report struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Code        string    `json:"code" gorm:"size:100;uniqueIndex"` // Identifier carried in tokens (ej: "sales_by_zone")
+	Name        string    `json:"name" gorm:"size:100"`
+	Description string    `json:"description" gorm:"size:255"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ParseReportCodes splits a legacy free-form reports value. Codes were
+// separated by commas, semicolons, pipes or spaces, sometimes written as a
+// JSON array.
+func ParseReportCodes(value string) []string {
+	codes := []string{}
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(",;| \t\n\r[]\"", r)
+	})
+	for _, code := range fields {
+		if !containsCode(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func containsCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
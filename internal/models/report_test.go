@@ -0,0 +1,46 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseReportCodes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"SALES", []string{"SALES"}},
+		{"SALES,STOCK", []string{"SALES", "STOCK"}},
+		{"SALES; STOCK |PRICES", []string{"SALES", "STOCK", "PRICES"}},
+		{"SALES STOCK\nPRICES", []string{"SALES", "STOCK", "PRICES"}},
+		{`["SALES", "STOCK"]`, []string{"SALES", "STOCK"}},
+		{"SALES,,STOCK,SALES", []string{"SALES", "STOCK"}},
+	}
+	for _, tt := range tests {
+		if got := ParseReportCodes(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseReportCodes(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReportCodes(t *testing.T) {
+	now := time.Now()
+	u := &User{
+		Reports: []Report{{Code: "OWN"}, {Code: "SALES"}},
+		Role:    Role{Reports: []Report{{Code: "SALES"}, {Code: "STOCK"}}},
+		Roles:   []Role{{Reports: []Report{{Code: "PRICES"}}}},
+		RoleGrants: []RoleGrant{
+			{Status: RoleGrantApproved, ValidFrom: now.Add(-time.Hour), Role: &Role{Reports: []Report{{Code: "AUDIT"}}}},
+			{Status: RoleGrantPending, ValidFrom: now.Add(-time.Hour), Role: &Role{Reports: []Report{{Code: "SECRET"}}}},
+		},
+	}
+
+	want := []string{"OWN", "SALES", "STOCK", "PRICES", "AUDIT"}
+	if got := u.ReportCodes(now); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
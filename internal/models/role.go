@@ -3,10 +3,17 @@ package models
 import "time"
 
 type Role struct {
-	ID          uint         `json:"id" gorm:"primaryKey"`
-	Name        string       `json:"name" gorm:"unique"`
-	Description string       `json:"description"`
-	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
-	CreatedAt   time.Time    `json:"createdAt"`
-	UpdatedAt   time.Time    `json:"updatedAt"`
+	ID                 uint            `json:"id" gorm:"primaryKey"`
+	TenantID           uint            `json:"tenantId" gorm:"not null;default:1;uniqueIndex:idx_roles_tenant_name"`
+	Name               string          `json:"name" gorm:"size:50;uniqueIndex:idx_roles_tenant_name"` // Unique within the tenant
+	Description        string          `json:"description"`
+	Permissions        []Permission    `json:"permissions" gorm:"many2many:role_permissions;"`
+	Reports            []Report        `json:"reports" gorm:"many2many:role_reports;"`                                              // Reports every user of the role may see
+	Parents            []Role          `json:"parents" gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID"` // The role inherits their permissions
+	RequiresApproval   bool            `json:"requiresApproval"`                                                                    // Elevated role: only granted for a window, after approval
+	MaxGrantHours      int             `json:"maxGrantHours"`                                                                       // Longest window a grant may last, 0 no limit
+	PasswordMaxAgeDays int             `json:"passwordMaxAgeDays"`                                                                  // Days a password is valid for the role's users, 0 never expires
+	DataScopes         []DataScopeRule `json:"dataScopes" gorm:"constraint:OnDelete:CASCADE"`                                       // Users outside every rule are hidden from the role
+	CreatedAt          time.Time       `json:"createdAt"`
+	UpdatedAt          time.Time       `json:"updatedAt"`
 }
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// RoleGrant gives a user an extra role for a bounded window. Grants of roles
+// that require approval start pending until another admin approves them.
+type RoleGrant struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"userId" gorm:"not null;index"`
+	User        *User      `json:"user,omitempty"`
+	RoleID      uint       `json:"roleId" gorm:"not null"`
+	Role        *Role      `json:"role,omitempty"`
+	Reason      string     `json:"reason" gorm:"size:255"`
+	Status      string     `json:"status" gorm:"size:20;not null;index"`
+	ValidFrom   time.Time  `json:"validFrom"`
+	ValidUntil  *time.Time `json:"validUntil"` // Empty never expires, only for direct grants
+	RequestedBy uint       `json:"requestedBy"`
+	DecidedBy   *uint      `json:"decidedBy"`
+	DecidedAt   *time.Time `json:"decidedAt"`
+	EndedAt     *time.Time `json:"endedAt"` // When it was revoked or expired
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// Role grant states
+const (
+	RoleGrantPending  = "pending"
+	RoleGrantApproved = "approved"
+	RoleGrantRejected = "rejected"
+	RoleGrantRevoked  = "revoked"
+	RoleGrantExpired  = "expired"
+)
+
+// Active reports whether the grant gives its role at now
+func (g *RoleGrant) Active(now time.Time) bool {
+	if g.Status != RoleGrantApproved || now.Before(g.ValidFrom) {
+		return false
+	}
+	return g.ValidUntil == nil || now.Before(*g.ValidUntil)
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEffectiveRoleIDs(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	u := &User{
+		RoleID: 1,
+		Roles:  []Role{{ID: 1}, {ID: 2}},
+		RoleGrants: []RoleGrant{
+			{RoleID: 3, Status: RoleGrantApproved, ValidFrom: before, ValidUntil: &after},
+			{RoleID: 4, Status: RoleGrantApproved, ValidFrom: before},
+			{RoleID: 2, Status: RoleGrantApproved, ValidFrom: before},
+			{RoleID: 5, Status: RoleGrantApproved, ValidFrom: after},
+			{RoleID: 6, Status: RoleGrantApproved, ValidFrom: before.Add(-time.Hour), ValidUntil: &before},
+			{RoleID: 7, Status: RoleGrantApproved, ValidFrom: before, ValidUntil: &now},
+			{RoleID: 8, Status: RoleGrantPending, ValidFrom: before},
+			{RoleID: 9, Status: RoleGrantRevoked, ValidFrom: before},
+		},
+	}
+
+	want := []uint{1, 2, 3, 4}
+	if got := u.EffectiveRoleIDs(now); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v: active grants only, without duplicates", got, want)
+	}
+}
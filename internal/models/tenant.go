@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DefaultTenantID is the tenant every record created before tenants belongs
+// to. Its admins manage the other tenants.
+const DefaultTenantID uint = 1
+
+// Tenant is an organization with its own users, roles and permissions
+type Tenant struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"size:100;uniqueIndex"`
+	Description string    `json:"description" gorm:"size:255"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
@@ -9,4 +9,5 @@ type TokenDetail struct {
 	RefreshUuid  string    `json:"-"`
 	AtExpires    time.Time `json:"-"`
 	RtExpires    time.Time `json:"-"`
+	Scope        string    `json:"-"` // Set for restricted tokens, which have no refresh token
 }
@@ -1,21 +1,176 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type User struct {
-	ID             uint      `json:"id" gorm:"primaryKey"`
-	Email          string    `json:"email" gorm:"unique"`
-	Password       string    `json:"-" gorm:"not null"`
-	UserName       string    `json:"userName"`
-	Name           string    `json:"name"`
-	LastName       string    `json:"lastName"`
-	CommercialZone string    `json:"commercialZone"`
-	Warehouse      string    `json:"warehouse"`
-	RoleID         uint      `json:"roleId"`
-	Role           Role      `json:"role"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-	OtherWarehouse string    `json:"otherWarehouse"`
-	Province       string    `json:"province"`
-	Reports        string    `json:"reports"`
+	ID             uint        `json:"id" gorm:"primaryKey"`
+	TenantID       uint        `json:"tenantId" gorm:"not null;default:1;index"`
+	Email          string      `json:"email" gorm:"unique"`
+	Password       string      `json:"-" gorm:"not null"`
+	UserName       *string     `json:"userName" gorm:"column:user_name;size:100;uniqueIndex:idx_users_user_name"`
+	Name           string      `json:"name"`
+	LastName       string      `json:"lastName"`
+	CommercialZone string      `json:"commercialZone"`
+	Warehouse      string      `json:"warehouse"`
+	RoleID         uint        `json:"roleId"` // Primary role, always one of Roles
+	Role           Role        `json:"role"`
+	Roles          []Role      `json:"roles" gorm:"many2many:user_roles;"`
+	RoleGrants     []RoleGrant `json:"roleGrants,omitempty"` // Approved temporary roles, loaded with the user
+	CreatedAt      time.Time   `json:"createdAt"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+	Warehouses     []Warehouse `json:"warehouses" gorm:"many2many:user_warehouses;"` // Sites the user may work at besides Warehouse
+	OtherWarehouse string      `json:"-"`                                            // Legacy free-form list, copied to Warehouses by migration 017
+	Province       string      `json:"province"`
+	Reports        []Report    `json:"reports" gorm:"many2many:user_reports;"` // Reports granted to the user, besides the ones of their roles
+	LegacyReports  string      `json:"-" gorm:"column:reports"`                // Legacy free-form list, copied to Reports by migration 016
+	AuthProvider   string      `json:"authProvider" gorm:"size:20;default:local"`
+	Status         string      `json:"status" gorm:"size:20;default:active"`
+
+	// Why and by whom the status was set; suspensions may start later and expire
+	StatusReason    string     `json:"statusReason" gorm:"size:255"`
+	StatusChangedBy *uint      `json:"statusChangedBy"`
+	StatusFrom      *time.Time `json:"statusFrom"`
+	StatusUntil     *time.Time `json:"statusUntil"`
+
+	// Password policy
+	MustChangePassword bool       `json:"mustChangePassword"`
+	PasswordChangedAt  *time.Time `json:"passwordChangedAt"`
+}
+
+// RoleIDs returns the IDs of every role of the user, starting with the primary one
+func (u *User) RoleIDs() []uint {
+	ids := []uint{}
+	if u.RoleID != 0 {
+		ids = append(ids, u.RoleID)
+	}
+	for _, role := range u.Roles {
+		if role.ID != u.RoleID {
+			ids = append(ids, role.ID)
+		}
+	}
+	return ids
+}
+
+// EffectiveRoleIDs adds the roles of the grants active at now to RoleIDs
+func (u *User) EffectiveRoleIDs(now time.Time) []uint {
+	ids := u.RoleIDs()
+	for _, grant := range u.RoleGrants {
+		if grant.Active(now) && !containsID(ids, grant.RoleID) {
+			ids = append(ids, grant.RoleID)
+		}
+	}
+	return ids
+}
+
+// ReportCodes returns the codes of the reports of the user and of the roles
+// returned by EffectiveRoleIDs, as far as they were loaded with the user.
+// Unlike permissions, reports are not inherited from parent roles.
+func (u *User) ReportCodes(now time.Time) []string {
+	codes := []string{}
+	add := func(reports []Report) {
+		for _, report := range reports {
+			if !containsCode(codes, report.Code) {
+				codes = append(codes, report.Code)
+			}
+		}
+	}
+
+	add(u.Reports)
+	add(u.Role.Reports)
+	for _, role := range u.Roles {
+		add(role.Reports)
+	}
+	for _, grant := range u.RoleGrants {
+		if grant.Active(now) && grant.Role != nil {
+			add(grant.Role.Reports)
+		}
+	}
+	return codes
+}
+
+// OtherWarehouseCodes returns the comma-separated codes of the warehouses of
+// the user other than Warehouse, the format of the other_warehouse claim
+func (u *User) OtherWarehouseCodes() string {
+	codes := []string{}
+	for _, warehouse := range u.Warehouses {
+		if warehouse.Code != u.Warehouse && !containsCode(codes, warehouse.Code) {
+			codes = append(codes, warehouse.Code)
+		}
+	}
+	return strings.Join(codes, ",")
+}
+
+// CanUseWarehouse reports whether the user may pick the warehouse as active site
+func (u *User) CanUseWarehouse(code string) bool {
+	if code == u.Warehouse {
+		return true
+	}
+	for _, warehouse := range u.Warehouses {
+		if warehouse.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Credential sources a user can authenticate against
+const (
+	AuthProviderLocal = "local"
+	AuthProviderLDAP  = "ldap"
+	AuthProviderOIDC  = "oidc"
+	AuthProviderSAML  = "saml"
+)
+
+// Account states
+const (
+	UserStatusActive    = "active"
+	UserStatusPending   = "pending"   // Invited, waiting for the user to set a password
+	UserStatusSuspended = "suspended" // Temporarily blocked by an admin
+	UserStatusLocked    = "locked"    // Blocked for security reasons
+	UserStatusDisabled  = "disabled"  // Blocked until an admin reactivates it
+)
+
+// Blocked reports whether a suspended, locked or disabled status is in effect at now
+func (u *User) Blocked(now time.Time) bool {
+	switch u.Status {
+	case UserStatusSuspended, UserStatusLocked, UserStatusDisabled:
+	default:
+		return false
+	}
+	if u.StatusFrom != nil && now.Before(*u.StatusFrom) {
+		return false
+	}
+	if u.StatusUntil != nil && !now.Before(*u.StatusUntil) {
+		return false
+	}
+	return true
+}
+
+// NextStatusChange returns when Blocked will next change its answer after now,
+// nil when no scheduled status starts or ends
+func (u *User) NextStatusChange(now time.Time) *time.Time {
+	switch u.Status {
+	case UserStatusSuspended, UserStatusLocked, UserStatusDisabled:
+	default:
+		return nil
+	}
+	if u.StatusFrom != nil && now.Before(*u.StatusFrom) {
+		return u.StatusFrom
+	}
+	if u.StatusUntil != nil && now.Before(*u.StatusUntil) {
+		return u.StatusUntil
+	}
+	return nil
 }
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserBlockedAndNextStatusChange(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		status  string
+		from    *time.Time
+		until   *time.Time
+		blocked bool
+		next    *time.Time
+	}{
+		{"active", UserStatusActive, nil, nil, false, nil},
+		{"active ignores the window", UserStatusActive, &before, &after, false, nil},
+		{"pending is not blocked", UserStatusPending, nil, nil, false, nil},
+		{"suspended without window", UserStatusSuspended, nil, nil, true, nil},
+		{"locked", UserStatusLocked, nil, nil, true, nil},
+		{"disabled", UserStatusDisabled, nil, nil, true, nil},
+		{"suspension not started", UserStatusSuspended, &after, nil, false, &after},
+		{"suspension started", UserStatusSuspended, &before, nil, true, nil},
+		{"suspension starts now", UserStatusSuspended, &now, nil, true, nil},
+		{"suspension until later", UserStatusSuspended, nil, &after, true, &after},
+		{"suspension ended", UserStatusSuspended, nil, &before, false, nil},
+		{"suspension ends now", UserStatusSuspended, nil, &now, false, nil},
+		{"within the window", UserStatusSuspended, &before, &after, true, &after},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &User{Status: tt.status, StatusFrom: tt.from, StatusUntil: tt.until}
+
+			if got := u.Blocked(now); got != tt.blocked {
+				t.Fatalf("Blocked = %v, want %v", got, tt.blocked)
+			}
+			next := u.NextStatusChange(now)
+			if (next == nil) != (tt.next == nil) || (next != nil && !next.Equal(*tt.next)) {
+				t.Fatalf("NextStatusChange = %v, want %v", next, tt.next)
+			}
+			// Blocked keeps its answer until the next change
+			if next != nil && u.Blocked(next.Add(-time.Nanosecond)) != tt.blocked {
+				t.Fatal("Blocked changed before NextStatusChange")
+			}
+			if next != nil && u.Blocked(*next) == tt.blocked {
+				t.Fatal("Blocked did not change at NextStatusChange")
+			}
+		})
+	}
+}
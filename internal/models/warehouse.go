@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Warehouse is a site of the warehouses catalogue. Its code is the value of
+// the user's warehouse and of the warehouse claims.
+type Warehouse struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Code      string    `json:"code" gorm:"size:100;uniqueIndex"`
+	Name      string    `json:"name" gorm:"size:100"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,35 @@
+package permission
+
+import "github.com/j94veron/auth-service-insu/internal/models"
+
+// invalidatingRepository calls invalidate after every change to an existing
+// permission, which can alter what the roles holding it are allowed to do
+type invalidatingRepository struct {
+	Repository
+	invalidate func()
+}
+
+// WithInvalidation wraps the repository so caches of role data are dropped on changes
+func WithInvalidation(repo Repository, invalidate func()) Repository {
+	return &invalidatingRepository{Repository: repo, invalidate: invalidate}
+}
+
+func (r *invalidatingRepository) ForTenant(tenantID uint) Repository {
+	return WithInvalidation(r.Repository.ForTenant(tenantID), r.invalidate)
+}
+
+func (r *invalidatingRepository) Update(permission *models.Permission) error {
+	err := r.Repository.Update(permission)
+	if err == nil {
+		r.invalidate()
+	}
+	return err
+}
+
+func (r *invalidatingRepository) Delete(id uint) error {
+	err := r.Repository.Delete(id)
+	if err == nil {
+		r.invalidate()
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package permission
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindByID(id uint) (*models.Permission, error)
+	FindByIDs(ids []uint) ([]models.Permission, error)
+	List() ([]models.Permission, error)
+	Create(permission *models.Permission) error
+	Update(permission *models.Permission) error
+	Delete(id uint) error
+	Exists(resource, endpoint, method string, excludeID uint) (bool, error)
+	CountRoles(id uint) (int64, error)
+
+	// ForTenant returns a repository that only reaches and creates permissions of the tenant
+	ForTenant(tenantID uint) Repository
+}
+
+type repository struct {
+	db       *gorm.DB
+	tenantID uint // 0 reaches every tenant
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ForTenant(tenantID uint) Repository {
+	return &repository{db: r.db, tenantID: tenantID}
+}
+
+// query starts a permissions query limited to the tenant
+func (r *repository) query() *gorm.DB {
+	if r.tenantID == 0 {
+		return r.db
+	}
+	return r.db.Where("permissions.tenant_id = ?", r.tenantID)
+}
+
+func (r *repository) FindByID(id uint) (*models.Permission, error) {
+	var permission models.Permission
+	if err := r.query().First(&permission, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("permission not found")
+		}
+		return nil, err
+	}
+	return &permission, nil
+}
+
+func (r *repository) FindByIDs(ids []uint) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(ids) == 0 {
+		return permissions, nil
+	}
+	if err := r.query().Where("id IN ?", ids).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *repository) List() ([]models.Permission, error) {
+	var permissions []models.Permission
+	if err := r.query().Order("resource, endpoint, method").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *repository) Create(permission *models.Permission) error {
+	if r.tenantID != 0 {
+		permission.TenantID = r.tenantID
+	}
+	return r.db.Create(permission).Error
+}
+
+func (r *repository) Update(permission *models.Permission) error {
+	if r.tenantID != 0 && permission.TenantID != r.tenantID {
+		return errors.New("permission not found")
+	}
+	return r.db.Save(permission).Error
+}
+
+func (r *repository) Delete(id uint) error {
+	return r.query().Delete(&models.Permission{}, id).Error
+}
+
+// Exists checks the unique_permission index within the tenant, ignoring the
+// permission excludeID
+func (r *repository) Exists(resource, endpoint, method string, excludeID uint) (bool, error) {
+	var count int64
+	query := r.query().Model(&models.Permission{}).
+		Where("resource = ? AND endpoint = ? AND method = ?", resource, endpoint, method)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountRoles returns how many roles the permission is assigned to
+func (r *repository) CountRoles(id uint) (int64, error) {
+	var count int64
+	err := r.db.Table("role_permissions").Where("permission_id = ?", id).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindByID(id uint) (*models.Report, error)
+	FindByIDs(ids []uint) ([]models.Report, error)
+	List() ([]models.Report, error)
+	Create(report *models.Report) error
+	Update(report *models.Report) error
+	Delete(id uint) error
+	CodeExists(code string, excludeID uint) (bool, error)
+	CountEntitlements(id uint) (users int64, roles int64, err error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) FindByID(id uint) (*models.Report, error) {
+	var report models.Report
+	if err := r.db.First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("report not found")
+		}
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *repository) FindByIDs(ids []uint) ([]models.Report, error) {
+	var reports []models.Report
+	if len(ids) == 0 {
+		return reports, nil
+	}
+	if err := r.db.Where("id IN ?", ids).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *repository) List() ([]models.Report, error) {
+	var reports []models.Report
+	if err := r.db.Order("code").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *repository) Create(report *models.Report) error {
+	return r.db.Create(report).Error
+}
+
+func (r *repository) Update(report *models.Report) error {
+	return r.db.Save(report).Error
+}
+
+func (r *repository) Delete(id uint) error {
+	return r.db.Delete(&models.Report{}, id).Error
+}
+
+// CodeExists reports whether another report (other than excludeID) already uses the code
+func (r *repository) CodeExists(code string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Report{}).
+		Where("code = ? AND id <> ?", code, excludeID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountEntitlements returns how many users and roles the report is assigned to
+func (r *repository) CountEntitlements(id uint) (int64, int64, error) {
+	var users, roles int64
+	if err := r.db.Table("user_reports").Where("report_id = ?", id).Count(&users).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := r.db.Table("role_reports").Where("report_id = ?", id).Count(&roles).Error; err != nil {
+		return 0, 0, err
+	}
+	return users, roles, nil
+}
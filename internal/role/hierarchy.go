@@ -0,0 +1,137 @@
+package role
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrRoleCycle is returned when a role would end up inheriting from itself
+var ErrRoleCycle = errors.New("role hierarchy cycle")
+
+// EffectivePermission is a permission of a role together with the roles,
+// the role itself or its ancestors, that grant it
+type EffectivePermission struct {
+	models.Permission
+	GrantedBy []RoleRef `json:"grantedBy"`
+}
+
+type RoleRef struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// WithAncestors returns the roles and every role they inherit from, transitively
+func (r *repository) WithAncestors(roleIDs []uint) ([]uint, error) {
+	seen := map[uint]bool{}
+	all := []uint{}
+	pending := roleIDs
+	for len(pending) > 0 {
+		next := []uint{}
+		for _, id := range pending {
+			if !seen[id] {
+				seen[id] = true
+				all = append(all, id)
+				next = append(next, id)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+
+		var parents []uint
+		if err := r.db.Table("role_parents").Where("role_id IN ?", next).Pluck("parent_id", &parents).Error; err != nil {
+			return nil, err
+		}
+		pending = parents
+	}
+	return all, nil
+}
+
+// SetParents replaces the parents of the role, refusing changes that would
+// make the role its own ancestor
+func (r *repository) SetParents(roleID uint, parentIDs []uint) error {
+	if err := r.checkParents(roleID, parentIDs); err != nil {
+		return err
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceParents(tx, roleID, parentIDs)
+	})
+}
+
+// checkParents returns ErrRoleCycle when the role is among the ancestors of the parents
+func (r *repository) checkParents(roleID uint, parentIDs []uint) error {
+	ancestors, err := r.WithAncestors(parentIDs)
+	if err != nil {
+		return err
+	}
+	for _, id := range ancestors {
+		if id == roleID {
+			return ErrRoleCycle
+		}
+	}
+	return nil
+}
+
+func replaceParents(tx *gorm.DB, roleID uint, parentIDs []uint) error {
+	if err := tx.Exec("DELETE FROM role_parents WHERE role_id = ?", roleID).Error; err != nil {
+		return err
+	}
+	for _, parentID := range parentIDs {
+		if err := tx.Exec("INSERT INTO role_parents (role_id, parent_id) VALUES (?, ?)", roleID, parentID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roleIDs returns the IDs of the roles
+func roleIDs(roles []models.Role) []uint {
+	ids := make([]uint, 0, len(roles))
+	for _, r := range roles {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+// EffectivePermissions returns the permissions of the roles and their ancestors
+func (r *repository) EffectivePermissions(roleIDs []uint) ([]EffectivePermission, error) {
+	roleIDs, err := r.WithAncestors(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	if err := r.db.Preload("Permissions").Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	// Keep the order of WithAncestors: the roles first, then nearer ancestors
+	order := make(map[uint]int, len(roleIDs))
+	for i, id := range roleIDs {
+		order[id] = i
+	}
+	sorted := make([]*models.Role, len(roleIDs))
+	for i := range roles {
+		sorted[order[roles[i].ID]] = &roles[i]
+	}
+
+	effective := []EffectivePermission{}
+	index := map[uint]int{}
+	for _, role := range sorted {
+		if role == nil {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			i, ok := index[permission.ID]
+			if !ok {
+				i = len(effective)
+				index[permission.ID] = i
+				effective = append(effective, EffectivePermission{Permission: permission})
+			}
+			effective[i].GrantedBy = append(effective[i].GrantedBy, RoleRef{ID: role.ID, Name: role.Name})
+		}
+	}
+	return effective, nil
+}
@@ -0,0 +1,54 @@
+package role
+
+import "github.com/j94veron/auth-service-insu/internal/models"
+
+// invalidatingRepository calls invalidate after every change that can alter
+// what a role is allowed to do
+type invalidatingRepository struct {
+	Repository
+	invalidate func()
+}
+
+// WithInvalidation wraps the repository so caches of role data are dropped on changes
+func WithInvalidation(repo Repository, invalidate func()) Repository {
+	return &invalidatingRepository{Repository: repo, invalidate: invalidate}
+}
+
+func (r *invalidatingRepository) changed(err error) error {
+	if err == nil {
+		r.invalidate()
+	}
+	return err
+}
+
+func (r *invalidatingRepository) ForTenant(tenantID uint) Repository {
+	return WithInvalidation(r.Repository.ForTenant(tenantID), r.invalidate)
+}
+
+func (r *invalidatingRepository) Update(role *models.Role) error {
+	return r.changed(r.Repository.Update(role))
+}
+
+func (r *invalidatingRepository) Delete(id uint) error {
+	return r.changed(r.Repository.Delete(id))
+}
+
+func (r *invalidatingRepository) SetPermissions(role *models.Role, permissions []models.Permission) error {
+	return r.changed(r.Repository.SetPermissions(role, permissions))
+}
+
+func (r *invalidatingRepository) AddPermissions(role *models.Role, permissions []models.Permission) error {
+	return r.changed(r.Repository.AddPermissions(role, permissions))
+}
+
+func (r *invalidatingRepository) RemovePermissions(role *models.Role, permissions []models.Permission) error {
+	return r.changed(r.Repository.RemovePermissions(role, permissions))
+}
+
+func (r *invalidatingRepository) SetDataScopes(roleID uint, rules []models.DataScopeRule) error {
+	return r.changed(r.Repository.SetDataScopes(roleID, rules))
+}
+
+func (r *invalidatingRepository) SetParents(roleID uint, parentIDs []uint) error {
+	return r.changed(r.Repository.SetParents(roleID, parentIDs))
+}
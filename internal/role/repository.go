@@ -2,31 +2,63 @@ package role
 
 import (
 	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/authz"
 	"github.com/j94veron/auth-service-insu/internal/models"
 	"gorm.io/gorm"
 )
 
 type Repository interface {
 	FindByID(id uint) (*models.Role, error)
+	FindByName(name string) (*models.Role, error)
 	Create(role *models.Role) error
 	Update(role *models.Role) error
 	Delete(id uint) error
 	List() ([]models.Role, error)
-	CheckPermission(roleID uint, endpoint, method string) (bool, error)
+	SetPermissions(role *models.Role, permissions []models.Permission) error
+	AddPermissions(role *models.Role, permissions []models.Permission) error
+	RemovePermissions(role *models.Role, permissions []models.Permission) error
+	SetReports(role *models.Role, reports []models.Report) error
+	FindByIDs(ids []uint) ([]models.Role, error)
+	Permissions(roleIDs []uint, method string) ([]models.Permission, error)
+	DataScopes(roleID uint) ([]models.DataScopeRule, error)
+	SetDataScopes(roleID uint, rules []models.DataScopeRule) error
 	GetRoleName(roleID uint) (string, error)
+
+	// ForTenant returns a repository whose lookups, updates and deletes only
+	// reach roles of the tenant, and that creates roles in it
+	ForTenant(tenantID uint) Repository
+
+	// Hierarchy
+	WithAncestors(roleIDs []uint) ([]uint, error)
+	SetParents(roleID uint, parentIDs []uint) error
+	EffectivePermissions(roleIDs []uint) ([]EffectivePermission, error)
 }
 
 type repository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID uint // 0 reaches every tenant
 }
 
 func NewRepository(db *gorm.DB) Repository {
-	return &repository{db}
+	return &repository{db: db}
+}
+
+func (r *repository) ForTenant(tenantID uint) Repository {
+	return &repository{db: r.db, tenantID: tenantID}
+}
+
+// query starts a roles query limited to the tenant
+func (r *repository) query() *gorm.DB {
+	if r.tenantID == 0 {
+		return r.db
+	}
+	return r.db.Where("roles.tenant_id = ?", r.tenantID)
 }
 
 func (r *repository) FindByID(id uint) (*models.Role, error) {
 	var role models.Role
-	if err := r.db.Preload("Permissions").First(&role, id).Error; err != nil {
+	if err := r.query().Preload("Permissions").Preload("Reports").Preload("Parents").Preload("DataScopes").First(&role, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("role not found")
 		}
@@ -35,40 +67,160 @@ func (r *repository) FindByID(id uint) (*models.Role, error) {
 	return &role, nil
 }
 
+func (r *repository) FindByName(name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.query().Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("role not found")
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Create creates the role with its permissions, reports and parents in one transaction
 func (r *repository) Create(role *models.Role) error {
-	return r.db.Create(role).Error
+	if r.tenantID != 0 {
+		role.TenantID = r.tenantID
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Parents").Create(role).Error; err != nil {
+			return err
+		}
+		if len(role.Parents) == 0 {
+			return nil
+		}
+		return replaceParents(tx, role.ID, roleIDs(role.Parents))
+	})
 }
 
+// Update saves the role and replaces its permissions, reports and parents in
+// one transaction; a nil association is kept as it is. Parents that would
+// create a cycle fail with ErrRoleCycle before anything is written.
 func (r *repository) Update(role *models.Role) error {
-	return r.db.Save(role).Error
+	if r.tenantID != 0 && role.TenantID != r.tenantID {
+		return errors.New("role not found")
+	}
+	if role.Parents != nil {
+		if err := r.checkParents(role.ID, roleIDs(role.Parents)); err != nil {
+			return err
+		}
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions", "Reports", "Parents").Save(role).Error; err != nil {
+			return err
+		}
+		if role.Permissions != nil {
+			if err := tx.Model(role).Association("Permissions").Replace(role.Permissions); err != nil {
+				return err
+			}
+		}
+		if role.Reports != nil {
+			if err := tx.Model(role).Association("Reports").Replace(role.Reports); err != nil {
+				return err
+			}
+		}
+		if role.Parents == nil {
+			return nil
+		}
+		return replaceParents(tx, role.ID, roleIDs(role.Parents))
+	})
 }
 
 func (r *repository) Delete(id uint) error {
-	return r.db.Delete(&models.Role{}, id).Error
+	result := r.query().Delete(&models.Role{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("role not found")
+	}
+	return nil
 }
 
 func (r *repository) List() ([]models.Role, error) {
 	var roles []models.Role
-	if err := r.db.Preload("Permissions").Find(&roles).Error; err != nil {
+	if err := r.query().Preload("Permissions").Preload("Reports").Preload("Parents").Preload("DataScopes").Find(&roles).Error; err != nil {
 		return nil, err
 	}
 	return roles, nil
 }
 
-func (r *repository) CheckPermission(roleID uint, endpoint, method string) (bool, error) {
-	var count int64
+// SetPermissions replaces every permission of the role
+func (r *repository) SetPermissions(role *models.Role, permissions []models.Permission) error {
+	return r.db.Model(role).Association("Permissions").Replace(permissions)
+}
+
+func (r *repository) AddPermissions(role *models.Role, permissions []models.Permission) error {
+	return r.db.Model(role).Association("Permissions").Append(permissions)
+}
+
+func (r *repository) RemovePermissions(role *models.Role, permissions []models.Permission) error {
+	return r.db.Model(role).Association("Permissions").Delete(permissions)
+}
+
+// SetReports replaces every report of the role
+func (r *repository) SetReports(role *models.Role, reports []models.Report) error {
+	return r.db.Model(role).Association("Reports").Replace(reports)
+}
+
+func (r *repository) FindByIDs(ids []uint) ([]models.Role, error) {
+	var roles []models.Role
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := r.query().Where("id IN ?", ids).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Permissions returns the permissions for the method (or any method) of the
+// roles and of the roles they inherit from
+func (r *repository) Permissions(roleIDs []uint, method string) ([]models.Permission, error) {
+	var permissions []models.Permission
 
-	err := r.db.Model(&models.Permission{}).
+	roleIDs, err := r.WithAncestors(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Model(&models.Permission{}).
+		Distinct("permissions.*").
 		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
-		Where("role_permissions.role_id = ? AND permissions.endpoint = ? AND permissions.method = ?",
-			roleID, endpoint, method).
-		Count(&count).Error
+		Where("role_permissions.role_id IN ? AND permissions.method IN ?", roleIDs, []string{method, authz.AnyMethod}).
+		Find(&permissions).Error
 
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *repository) DataScopes(roleID uint) ([]models.DataScopeRule, error) {
+	var rules []models.DataScopeRule
+	if err := r.db.Where("role_id = ?", roleID).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
 	}
+	return rules, nil
+}
 
-	return count > 0, nil
+// SetDataScopes replaces every data scope rule of the role
+func (r *repository) SetDataScopes(roleID uint, rules []models.DataScopeRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", roleID).Delete(&models.DataScopeRule{}).Error; err != nil {
+			return err
+		}
+		for i := range rules {
+			rules[i].ID = 0
+			rules[i].RoleID = roleID
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
 }
 
 func (r *repository) GetRoleName(roleID uint) (string, error) {
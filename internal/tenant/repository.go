@@ -0,0 +1,149 @@
+package tenant
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+// AdminRoleName is the role created with every tenant for its first user
+const AdminRoleName = "ADMIN"
+
+type Repository interface {
+	FindByID(id uint) (*models.Tenant, error)
+	List() ([]models.Tenant, error)
+	Create(tenant *models.Tenant, admin *models.User) error
+	Update(tenant *models.Tenant) error
+	Delete(id uint) error
+	NameExists(name string, excludeID uint) (bool, error)
+	CountUsers(id uint) (int64, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) FindByID(id uint) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := r.db.First(&tenant, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("tenant not found")
+		}
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (r *repository) List() ([]models.Tenant, error) {
+	var tenants []models.Tenant
+	if err := r.db.Order("id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// Create creates the tenant with a copy of the default tenant's permissions,
+// an ADMIN role holding all of them and admin as its first user. Tenant
+// management permissions are not copied: only the default tenant manages tenants.
+func (r *repository) Create(tenant *models.Tenant, admin *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(tenant).Error; err != nil {
+			return err
+		}
+
+		var templates []models.Permission
+		err := tx.Where("tenant_id = ? AND endpoint NOT LIKE ?", models.DefaultTenantID, "/api/tenants%").
+			Find(&templates).Error
+		if err != nil {
+			return err
+		}
+		permissions := make([]models.Permission, 0, len(templates))
+		for _, p := range templates {
+			permissions = append(permissions, models.Permission{
+				TenantID:    tenant.ID,
+				Resource:    p.Resource,
+				Endpoint:    p.Endpoint,
+				Method:      p.Method,
+				Effect:      p.Effect,
+				Description: p.Description,
+			})
+		}
+		if len(permissions) > 0 {
+			if err := tx.Create(&permissions).Error; err != nil {
+				return err
+			}
+		}
+
+		role := models.Role{
+			TenantID:    tenant.ID,
+			Name:        AdminRoleName,
+			Description: "Administrator of " + tenant.Name,
+			Permissions: permissions,
+		}
+		if err := tx.Omit("Permissions.*").Create(&role).Error; err != nil {
+			return err
+		}
+
+		admin.TenantID = tenant.ID
+		admin.RoleID = role.ID
+		if err := tx.Omit("Role", "Roles", "RoleGrants", "Reports", "Warehouses").Create(admin).Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", admin.ID, role.ID).Error
+	})
+}
+
+func (r *repository) Update(tenant *models.Tenant) error {
+	return r.db.Save(tenant).Error
+}
+
+// Delete removes the tenant with its roles and permissions. Callers make sure
+// the tenant has no users left.
+func (r *repository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		roles := "SELECT id FROM roles WHERE tenant_id = ?"
+		for _, statement := range []string{
+			"DELETE FROM role_permissions WHERE role_id IN (" + roles + ")",
+			"DELETE FROM role_reports WHERE role_id IN (" + roles + ")",
+			"DELETE FROM role_parents WHERE role_id IN (" + roles + ")",
+			"DELETE FROM role_parents WHERE parent_id IN (" + roles + ")",
+			"DELETE FROM data_scope_rules WHERE role_id IN (" + roles + ")",
+			"DELETE FROM role_grants WHERE role_id IN (" + roles + ")",
+		} {
+			if err := tx.Exec(statement, id).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("tenant_id = ?", id).Delete(&models.Role{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tenant_id = ?", id).Delete(&models.Permission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tenant{}, id).Error
+	})
+}
+
+// NameExists checks whether another tenant (other than excludeID) already uses the name
+func (r *repository) NameExists(name string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Tenant{}).
+		Where("name = ? AND id <> ?", name, excludeID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountUsers returns how many users belong to the tenant
+func (r *repository) CountUsers(id uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("tenant_id = ?", id).Count(&count).Error
+	return count, err
+}
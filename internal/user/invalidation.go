@@ -0,0 +1,39 @@
+package user
+
+import "github.com/j94veron/auth-service-insu/internal/models"
+
+// invalidatingRepository calls invalidate with the ID of every user that is
+// updated or deleted
+type invalidatingRepository struct {
+	Repository
+	invalidate func(userID uint)
+}
+
+// WithInvalidation wraps the repository so caches of user data are dropped on changes
+func WithInvalidation(repo Repository, invalidate func(userID uint)) Repository {
+	return &invalidatingRepository{Repository: repo, invalidate: invalidate}
+}
+
+func (r *invalidatingRepository) WithScope(scope *Scope) Repository {
+	return WithInvalidation(r.Repository.WithScope(scope), r.invalidate)
+}
+
+func (r *invalidatingRepository) ForTenant(tenantID uint) Repository {
+	return WithInvalidation(r.Repository.ForTenant(tenantID), r.invalidate)
+}
+
+func (r *invalidatingRepository) Update(user *models.User) error {
+	err := r.Repository.Update(user)
+	if err == nil {
+		r.invalidate(user.ID)
+	}
+	return err
+}
+
+func (r *invalidatingRepository) Delete(id uint) error {
+	err := r.Repository.Delete(id)
+	if err == nil {
+		r.invalidate(id)
+	}
+	return err
+}
@@ -2,34 +2,69 @@ package user
 
 import (
 	"errors"
+	"strings"
+	"time"
+
 	"github.com/j94veron/auth-service-insu/internal/models"
 	"gorm.io/gorm"
 )
 
+// ErrOutOfScope is returned when a scoped repository is asked to change a user outside its scope
+var ErrOutOfScope = errors.New("user not found")
+
 type Repository interface {
 	FindByID(id uint) (*models.User, error)
 	FindByEmail(email string) (*models.User, error)
 	FindByUsername(username string) (*models.User, error)
+	UsernameExists(username string, excludeID uint) (bool, error)
 	Create(user *models.User) error
 	Update(user *models.User) error
 	Delete(id uint) error
 	List() ([]models.User, error)
 
+	// WithScope returns a repository whose FindByID, List, Update and Delete
+	// only reach users inside the scope
+	WithScope(scope *Scope) Repository
+
+	// ForTenant returns a repository whose FindByID, List, Update and Delete
+	// only reach users of the tenant, and that creates users in it. Emails and
+	// usernames identify users across tenants, so lookups by them are not limited.
+	ForTenant(tenantID uint) Repository
+
 	// New feature to check user restrictions
-	IsUserRestricted(id uint) (bool, error)
+	IsUserRestricted(id uint) (bool, *time.Time, error)
 }
 
 type repository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	scope    *Scope
+	tenantID uint // 0 reaches every tenant
 }
 
 func NewRepository(db *gorm.DB) Repository {
-	return &repository{db}
+	return &repository{db: db}
+}
+
+func (r *repository) WithScope(scope *Scope) Repository {
+	return &repository{db: r.db, scope: scope, tenantID: r.tenantID}
+}
+
+func (r *repository) ForTenant(tenantID uint) Repository {
+	return &repository{db: r.db, scope: r.scope, tenantID: tenantID}
+}
+
+// query starts a users query limited to the tenant and the scope
+func (r *repository) query() *gorm.DB {
+	db := r.db
+	if r.tenantID != 0 {
+		db = db.Where("users.tenant_id = ?", r.tenantID)
+	}
+	return r.scope.apply(db)
 }
 
 func (r *repository) FindByID(id uint) (*models.User, error) {
 	var user models.User
-	if err := r.db.Preload("Role.Permissions").First(&user, id).Error; err != nil {
+	if err := withEntitlements(r.query()).Preload("Role.Permissions").First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("user not found\n")
 		}
@@ -40,7 +75,7 @@ func (r *repository) FindByID(id uint) (*models.User, error) {
 
 func (r *repository) FindByEmail(email string) (*models.User, error) {
 	var user models.User
-	if err := r.db.Preload("Role.Permissions").Where("email = ?", email).First(&user).Error; err != nil {
+	if err := withEntitlements(r.db).Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("mail not found")
 		}
@@ -51,7 +86,7 @@ func (r *repository) FindByEmail(email string) (*models.User, error) {
 
 func (r *repository) FindByUsername(username string) (*models.User, error) {
 	var user models.User
-	if err := r.db.Preload("Role.Permissions").Where("username = ?", username).First(&user).Error; err != nil {
+	if err := withEntitlements(r.db).Where("user_name = ?", NormalizeUsername(username)).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("user not found")
 		}
@@ -60,30 +95,162 @@ func (r *repository) FindByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// UsernameExists reports whether another user (other than excludeID) already uses the username
+func (r *repository) UsernameExists(username string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).
+		Where("user_name = ? AND id <> ?", NormalizeUsername(username), excludeID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// NormalizeUsername trims and lowercases a username so that lookups and the
+// unique index are case-insensitive
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Create saves the user with its roles, reports and warehouses; the primary
+// role is always one of the roles
 func (r *repository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+	if r.tenantID != 0 {
+		user.TenantID = r.tenantID
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Role", "Roles", "RoleGrants", "Reports", "Warehouses").Create(user).Error; err != nil {
+			return err
+		}
+		if err := setRoles(tx, user); err != nil {
+			return err
+		}
+		if err := setReports(tx, user); err != nil {
+			return err
+		}
+		return setWarehouses(tx, user)
+	})
 }
 
+// Update saves the user and its roles. The reports and warehouses are only
+// replaced when user.Reports and user.Warehouses are not nil, so users loaded
+// without them keep their rows. A scoped repository refuses users that are,
+// or would end up, outside its scope or tenant.
 func (r *repository) Update(user *models.User) error {
-	return r.db.Save(user).Error
+	if r.scope != nil || r.tenantID != 0 {
+		if !r.scope.Allows(user) || (r.tenantID != 0 && user.TenantID != r.tenantID) {
+			return ErrOutOfScope
+		}
+		var count int64
+		if err := r.query().Model(&models.User{}).Where("id = ?", user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrOutOfScope
+		}
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Role", "Roles", "RoleGrants", "Reports", "Warehouses").Save(user).Error; err != nil {
+			return err
+		}
+		if err := setRoles(tx, user); err != nil {
+			return err
+		}
+		if user.Reports != nil {
+			if err := setReports(tx, user); err != nil {
+				return err
+			}
+		}
+		if user.Warehouses != nil {
+			return setWarehouses(tx, user)
+		}
+		return nil
+	})
+}
+
+// withEntitlements preloads what tokens are built from: the roles and active
+// role grants of the user, the reports of all of them and the warehouses
+func withEntitlements(db *gorm.DB) *gorm.DB {
+	return db.Preload("Role.Reports").
+		Preload("Roles.Reports").
+		Preload("RoleGrants", activeGrants).
+		Preload("RoleGrants.Role.Reports").
+		Preload("Reports").
+		Preload("Warehouses")
+}
+
+// activeGrants limits preloaded role grants to approved ones that have not ended
+func activeGrants(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ? AND (valid_until IS NULL OR valid_until > ?)", models.RoleGrantApproved, time.Now())
+}
+
+// setRoles replaces the user_roles rows of the user with user.RoleIDs()
+func setRoles(tx *gorm.DB, user *models.User) error {
+	if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", user.ID).Error; err != nil {
+		return err
+	}
+	for _, roleID := range user.RoleIDs() {
+		if err := tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", user.ID, roleID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setReports replaces the user_reports rows of the user with user.Reports
+func setReports(tx *gorm.DB, user *models.User) error {
+	if err := tx.Exec("DELETE FROM user_reports WHERE user_id = ?", user.ID).Error; err != nil {
+		return err
+	}
+	for _, report := range user.Reports {
+		if err := tx.Exec("INSERT INTO user_reports (user_id, report_id) VALUES (?, ?)", user.ID, report.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setWarehouses replaces the user_warehouses rows of the user with user.Warehouses
+func setWarehouses(tx *gorm.DB, user *models.User) error {
+	if err := tx.Exec("DELETE FROM user_warehouses WHERE user_id = ?", user.ID).Error; err != nil {
+		return err
+	}
+	for _, warehouse := range user.Warehouses {
+		if err := tx.Exec("INSERT INTO user_warehouses (user_id, warehouse_id) VALUES (?, ?)", user.ID, warehouse.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *repository) Delete(id uint) error {
-	return r.db.Delete(&models.User{}, id).Error
+	result := r.query().Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if (r.scope != nil || r.tenantID != 0) && result.RowsAffected == 0 {
+		return ErrOutOfScope
+	}
+	return nil
 }
 
 func (r *repository) List() ([]models.User, error) {
 	var users []models.User
-	if err := r.db.Preload("Role").Find(&users).Error; err != nil {
+	if err := r.query().Preload("Role").Preload("Roles").Preload("Reports").Preload("Warehouses").Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-func (r *repository) IsUserRestricted(id uint) (bool, error) {
+// IsUserRestricted reports whether the account cannot be used right now:
+// pending activation, or blocked by a status in effect. It also returns when a
+// scheduled status starts or ends, nil when none is.
+func (r *repository) IsUserRestricted(id uint) (bool, *time.Time, error) {
 	var user models.User
 	if err := r.db.First(&user, id).Error; err != nil {
-		return false, err
+		return false, nil, err
 	}
-	return false, nil
+	now := time.Now()
+	return user.Status == models.UserStatusPending || user.Blocked(now), user.NextStatusChange(now), nil
 }
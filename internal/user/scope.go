@@ -0,0 +1,148 @@
+package user
+
+import (
+	"strings"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+// Caller holds the attributes of the authenticated user that data scope
+// placeholders are resolved against
+type Caller struct {
+	CommercialZone string
+	Warehouse      string
+	OtherWarehouse string
+	Province       string
+}
+
+// Scope restricts the users visible through a repository. A user is visible
+// when, for one of the caller's roles, each attribute matches one of its
+// allowed values. A nil Scope restricts nothing.
+type Scope struct {
+	alternatives []map[string][]string
+}
+
+// NewScope resolves the rules of each of the caller's roles. Rules on the same
+// attribute add up; a rule whose values resolve to nothing hides every user.
+// A role without rules is unrestricted, and so is the caller.
+func NewScope(rulesByRole [][]models.DataScopeRule, caller Caller) *Scope {
+	scope := &Scope{}
+	for _, rules := range rulesByRole {
+		if len(rules) == 0 {
+			return nil
+		}
+		allowed := map[string][]string{}
+		for _, rule := range rules {
+			values := allowed[rule.Attribute]
+			for _, value := range rule.Values {
+				values = append(values, caller.resolve(value)...)
+			}
+			allowed[rule.Attribute] = values
+		}
+		scope.alternatives = append(scope.alternatives, allowed)
+	}
+	if len(scope.alternatives) == 0 {
+		return nil
+	}
+	return scope
+}
+
+func (c Caller) resolve(value string) []string {
+	var resolved []string
+	switch value {
+	case models.ScopeValueCommercialZone:
+		resolved = []string{c.CommercialZone}
+	case models.ScopeValueWarehouse:
+		resolved = []string{c.Warehouse}
+	case models.ScopeValueOtherWarehouse:
+		resolved = strings.Split(c.OtherWarehouse, ",")
+	case models.ScopeValueProvince:
+		resolved = []string{c.Province}
+	default:
+		resolved = []string{value}
+	}
+
+	// The caller's empty attributes must not match users with no value
+	values := resolved[:0]
+	for _, v := range resolved {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Allows reports whether the user is inside the scope
+func (s *Scope) Allows(user *models.User) bool {
+	return s.AllowsAttributes(map[string]string{
+		models.ScopeAttributeCommercialZone: user.CommercialZone,
+		models.ScopeAttributeWarehouse:      user.Warehouse,
+		models.ScopeAttributeProvince:       user.Province,
+	})
+}
+
+// AllowsAttributes reports whether a resource with the given attributes
+// (keyed like the rules, e.g. "commercial_zone") is inside the scope
+func (s *Scope) AllowsAttributes(attributes map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for _, allowed := range s.alternatives {
+		if allowedMatches(allowed, attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedMatches(allowed map[string][]string, attributes map[string]string) bool {
+	for attribute, values := range allowed {
+		if !contains(values, attributes[attribute]) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply adds the scope conditions to a users query
+func (s *Scope) apply(db *gorm.DB) *gorm.DB {
+	if s == nil {
+		return db
+	}
+	condition := db.Session(&gorm.Session{NewDB: true})
+	for i, allowed := range s.alternatives {
+		group := db.Session(&gorm.Session{NewDB: true})
+		for attribute, values := range allowed {
+			if len(values) == 0 || !ValidScopeAttribute(attribute) {
+				group = group.Where("1 = 0")
+				continue
+			}
+			group = group.Where("users."+attribute+" IN ?", values)
+		}
+		if i == 0 {
+			condition = condition.Where(group)
+		} else {
+			condition = condition.Or(group)
+		}
+	}
+	return db.Where(condition)
+}
+
+// ValidScopeAttribute checks that the attribute is a user column rules can restrict
+func ValidScopeAttribute(attribute string) bool {
+	switch attribute {
+	case models.ScopeAttributeCommercialZone, models.ScopeAttributeWarehouse, models.ScopeAttributeProvince:
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
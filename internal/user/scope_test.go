@@ -0,0 +1,50 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+)
+
+func rule(attribute string, values ...string) models.DataScopeRule {
+	return models.DataScopeRule{Attribute: attribute, Values: values}
+}
+
+func TestScopeAllows(t *testing.T) {
+	caller := Caller{CommercialZone: "north", Warehouse: "W1", OtherWarehouse: "W2, W3", Province: "BA"}
+	north := &models.User{CommercialZone: "north", Warehouse: "W9", Province: "BA"}
+	south := &models.User{CommercialZone: "south", Warehouse: "W2", Province: "CBA"}
+
+	tests := []struct {
+		name        string
+		rulesByRole [][]models.DataScopeRule
+		caller      Caller
+		user        *models.User
+		want        bool
+	}{
+		{"no roles is unrestricted", nil, caller, south, true},
+		{"a role without rules is unrestricted", [][]models.DataScopeRule{{rule("commercial_zone", "north")}, nil}, caller, south, true},
+		{"literal value", [][]models.DataScopeRule{{rule("commercial_zone", "north")}}, caller, north, true},
+		{"literal value outside", [][]models.DataScopeRule{{rule("commercial_zone", "north")}}, caller, south, false},
+		{"caller's own attribute", [][]models.DataScopeRule{{rule("commercial_zone", models.ScopeValueCommercialZone)}}, caller, north, true},
+		{"caller's other warehouses", [][]models.DataScopeRule{{rule("warehouse", models.ScopeValueOtherWarehouse)}}, caller, south, true},
+		{"rules on one attribute add up", [][]models.DataScopeRule{{rule("province", "CBA"), rule("province", "BA")}}, caller, south, true},
+		{"every attribute of a role must match", [][]models.DataScopeRule{{rule("commercial_zone", "north"), rule("province", "CBA")}}, caller, north, false},
+		{"any role may match", [][]models.DataScopeRule{{rule("commercial_zone", "north")}, {rule("province", "CBA")}}, caller, south, true},
+		{"empty caller attribute hides users without value", [][]models.DataScopeRule{{rule("warehouse", models.ScopeValueWarehouse)}}, Caller{}, &models.User{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewScope(tt.rulesByRole, tt.caller).Allows(tt.user); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilScopeAllowsEverything(t *testing.T) {
+	var scope *Scope
+	if !scope.AllowsAttributes(map[string]string{"commercial_zone": "anything"}) {
+		t.Fatal("a nil scope must allow every resource")
+	}
+}
@@ -0,0 +1,88 @@
+package warehouse
+
+import (
+	"errors"
+
+	"github.com/j94veron/auth-service-insu/internal/models"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindByID(id uint) (*models.Warehouse, error)
+	FindByIDs(ids []uint) ([]models.Warehouse, error)
+	List() ([]models.Warehouse, error)
+	Create(warehouse *models.Warehouse) error
+	Update(warehouse *models.Warehouse) error
+	Delete(id uint) error
+	CodeExists(code string, excludeID uint) (bool, error)
+	CountUsers(id uint) (int64, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) FindByID(id uint) (*models.Warehouse, error) {
+	var warehouse models.Warehouse
+	if err := r.db.First(&warehouse, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("warehouse not found")
+		}
+		return nil, err
+	}
+	return &warehouse, nil
+}
+
+func (r *repository) FindByIDs(ids []uint) ([]models.Warehouse, error) {
+	var warehouses []models.Warehouse
+	if len(ids) == 0 {
+		return warehouses, nil
+	}
+	if err := r.db.Where("id IN ?", ids).Find(&warehouses).Error; err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
+
+func (r *repository) List() ([]models.Warehouse, error) {
+	var warehouses []models.Warehouse
+	if err := r.db.Order("code").Find(&warehouses).Error; err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
+
+func (r *repository) Create(warehouse *models.Warehouse) error {
+	return r.db.Create(warehouse).Error
+}
+
+func (r *repository) Update(warehouse *models.Warehouse) error {
+	return r.db.Save(warehouse).Error
+}
+
+func (r *repository) Delete(id uint) error {
+	return r.db.Delete(&models.Warehouse{}, id).Error
+}
+
+// CodeExists warehouses whether another warehouse (other than excludeID) already uses the code
+func (r *repository) CodeExists(code string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Warehouse{}).
+		Where("code = ? AND id <> ?", code, excludeID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountUsers returns how many users the warehouse is assigned to
+func (r *repository) CountUsers(id uint) (int64, error) {
+	var count int64
+	err := r.db.Table("user_warehouses").Where("warehouse_id = ?", id).Count(&count).Error
+	return count, err
+}
@@ -21,23 +21,27 @@ func init() {
 	cfg.OutputPaths = []string{"stdout"}
 	cfg.ErrorOutputPaths = []string{"stderr"}
 
-	// Add output to an information log file
-	infoLogPath := filepath.Join(currentDir, "logs", "auth-insu-info.log")
-	infoLogFile, err := os.OpenFile(infoLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		panic("Failed to open info.log file: " + err.Error())
-	}
-	defer infoLogFile.Close()
-	cfg.OutputPaths = append(cfg.OutputPaths, infoLogPath)
+	// Log files live in the logs directory of the working directory; without
+	// it (e.g. package tests) only the standard outputs are used
+	if info, err := os.Stat(filepath.Join(currentDir, "logs")); err == nil && info.IsDir() {
+		// Add output to an information log file
+		infoLogPath := filepath.Join(currentDir, "logs", "auth-insu-info.log")
+		infoLogFile, err := os.OpenFile(infoLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			panic("Failed to open info.log file: " + err.Error())
+		}
+		defer infoLogFile.Close()
+		cfg.OutputPaths = append(cfg.OutputPaths, infoLogPath)
 
-	// Add output to an error log file
-	errorLogPath := filepath.Join(currentDir, "logs", "auth-insu-error.log")
-	errorLogFile, err := os.OpenFile(errorLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		panic("Failed to open error.log file: " + err.Error())
+		// Add output to an error log file
+		errorLogPath := filepath.Join(currentDir, "logs", "auth-insu-error.log")
+		errorLogFile, err := os.OpenFile(errorLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			panic("Failed to open error.log file: " + err.Error())
+		}
+		defer errorLogFile.Close()
+		cfg.ErrorOutputPaths = append(cfg.ErrorOutputPaths, errorLogPath)
 	}
-	defer errorLogFile.Close()
-	cfg.ErrorOutputPaths = append(cfg.ErrorOutputPaths, errorLogPath)
 
 	l, err := cfg.Build()
 	if err != nil {
@@ -0,0 +1,19 @@
+-- The user_name column is created by GORM's AutoMigrate. Usernames are optional:
+-- empty values become NULL so they do not collide in the unique index.
+UPDATE users SET user_name = NULL WHERE TRIM(user_name) = '';
+UPDATE users SET user_name = LOWER(TRIM(user_name)) WHERE user_name IS NOT NULL;
+
+ALTER TABLE users MODIFY user_name VARCHAR(100) NULL;
+
+-- AutoMigrate creates idx_users_user_name from the model tag once usernames are
+-- clean, so the index is only added here when it does not exist yet
+SET @has_index = (
+SELECT COUNT(*) FROM information_schema.statistics
+WHERE table_schema = DATABASE() AND table_name = 'users' AND index_name = 'idx_users_user_name'
+);
+SET @create_index = IF(@has_index = 0,
+'CREATE UNIQUE INDEX idx_users_user_name ON users (user_name)',
+'DO 0');
+PREPARE create_index FROM @create_index;
+EXECUTE create_index;
+DEALLOCATE PREPARE create_index;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS federated_identities (
+id INT AUTO_INCREMENT PRIMARY KEY,
+user_id INT NOT NULL,
+provider VARCHAR(100) NOT NULL,
+subject VARCHAR(255) NOT NULL,
+email VARCHAR(100),
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+UNIQUE KEY idx_provider_subject (provider, subject),
+FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
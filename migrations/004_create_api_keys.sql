@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+id INT AUTO_INCREMENT PRIMARY KEY,
+name VARCHAR(100) NOT NULL,
+prefix VARCHAR(20) NOT NULL UNIQUE,
+secret_hash VARCHAR(64) NOT NULL,
+user_id INT NOT NULL,
+scopes JSON,
+expires_at TIMESTAMP NULL,
+last_used_at TIMESTAMP NULL,
+revoked_at TIMESTAMP NULL,
+created_by INT,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+INDEX idx_api_keys_user_id (user_id),
+FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+-- Columns are created by GORM's AutoMigrate. Existing passwords count as changed
+-- now, so enabling an expiry policy on a role does not lock everyone out at once.
+UPDATE users SET password_changed_at = NOW() WHERE password_changed_at IS NULL;
+UPDATE users SET must_change_password = FALSE WHERE must_change_password IS NULL;
+UPDATE roles SET password_max_age_days = 0 WHERE password_max_age_days IS NULL;
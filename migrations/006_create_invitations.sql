@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invitations (
+id INT AUTO_INCREMENT PRIMARY KEY,
+user_id INT NOT NULL,
+token_hash VARCHAR(64) NOT NULL UNIQUE,
+expires_at TIMESTAMP NOT NULL,
+sent_at TIMESTAMP NOT NULL,
+accepted_at TIMESTAMP NULL,
+revoked_at TIMESTAMP NULL,
+invited_by INT,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+INDEX idx_invitations_user_id (user_id),
+FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- The status column is created by GORM's AutoMigrate; existing users are active
+UPDATE users SET status = 'active' WHERE status IS NULL OR status = '';
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS known_devices (
+id INT AUTO_INCREMENT PRIMARY KEY,
+user_id INT NOT NULL,
+fingerprint VARCHAR(64) NOT NULL,
+device_id VARCHAR(255),
+user_agent VARCHAR(512),
+last_ip VARCHAR(45),
+last_country VARCHAR(2),
+first_seen_at TIMESTAMP NULL,
+last_seen_at TIMESTAMP NULL,
+UNIQUE INDEX idx_user_fingerprint (user_id, fingerprint),
+FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS login_events (
+id INT AUTO_INCREMENT PRIMARY KEY,
+user_id INT NOT NULL,
+ip VARCHAR(45),
+user_agent VARCHAR(512),
+device_id VARCHAR(255),
+country VARCHAR(2),
+latitude DOUBLE,
+longitude DOUBLE,
+has_location BOOLEAN DEFAULT FALSE,
+new_device BOOLEAN DEFAULT FALSE,
+unusual_country BOOLEAN DEFAULT FALSE,
+impossible_travel BOOLEAN DEFAULT FALSE,
+step_up BOOLEAN DEFAULT FALSE,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+INDEX idx_login_events_user_id (user_id),
+FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
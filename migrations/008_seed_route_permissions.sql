@@ -0,0 +1,24 @@
+-- Permissions for the protected routes. Access is now checked against these
+-- rows by endpoint and HTTP method instead of the hardcoded role names.
+INSERT IGNORE INTO permissions (resource, endpoint, method, description) VALUES
+('users', '/api/users', 'GET', 'List and read users'),
+('users', '/api/users', 'POST', 'Create users'),
+('users', '/api/users', 'PUT', 'Update users'),
+('users', '/api/users', 'DELETE', 'Delete users'),
+('roles', '/api/roles', 'GET', 'List and read roles'),
+('roles', '/api/roles', 'POST', 'Create roles'),
+('roles', '/api/roles', 'PUT', 'Update roles'),
+('roles', '/api/roles', 'DELETE', 'Delete roles'),
+('api-keys', '/api/api-keys', 'GET', 'List API keys'),
+('api-keys', '/api/api-keys', 'POST', 'Create API keys'),
+('api-keys', '/api/api-keys', 'DELETE', 'Revoke API keys'),
+('invitations', '/api/invitations', 'GET', 'List pending invitations'),
+('invitations', '/api/invitations', 'POST', 'Create and resend invitations'),
+('invitations', '/api/invitations', 'DELETE', 'Revoke invitations');
+
+-- Roles that were allowed by name keep their access
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint IN ('/api/users', '/api/roles', '/api/api-keys', '/api/invitations')
+WHERE roles.name IN ('ADMIN', 'USER_ROLE_SCAN');
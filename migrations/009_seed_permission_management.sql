@@ -0,0 +1,12 @@
+-- Permission management is granted to ADMIN only
+INSERT IGNORE INTO permissions (resource, endpoint, method, description) VALUES
+('permissions', '/api/permissions', 'GET', 'List and read permissions'),
+('permissions', '/api/permissions', 'POST', 'Create permissions'),
+('permissions', '/api/permissions', 'PUT', 'Update permissions'),
+('permissions', '/api/permissions', 'DELETE', 'Delete unassigned permissions');
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint = '/api/permissions'
+WHERE roles.name = 'ADMIN';
@@ -0,0 +1,7 @@
+-- Permission endpoints are now gin route patterns matched against the full
+-- route path. The endpoints used before covered every route of the resource.
+UPDATE permissions SET endpoint = CONCAT(endpoint, '/*')
+WHERE endpoint IN ('/api/users', '/api/roles', '/api/api-keys', '/api/invitations', '/api/permissions');
+
+-- The effect column is created by GORM's AutoMigrate; existing permissions allow
+UPDATE permissions SET effect = 'allow' WHERE effect IS NULL OR effect = '';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS data_scope_rules (
+id INT AUTO_INCREMENT PRIMARY KEY,
+role_id INT NOT NULL,
+attribute VARCHAR(30) NOT NULL,
+`values` TEXT,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+INDEX idx_data_scope_rules_role_id (role_id),
+FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
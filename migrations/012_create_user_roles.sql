@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+user_id INT NOT NULL,
+role_id INT NOT NULL,
+PRIMARY KEY (user_id, role_id),
+FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+
+-- The single role of each user becomes its primary role; users.role_id is kept
+INSERT IGNORE INTO user_roles (user_id, role_id)
+SELECT id, role_id FROM users WHERE role_id IS NOT NULL;
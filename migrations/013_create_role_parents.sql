@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS role_parents (
+role_id INT NOT NULL,
+parent_id INT NOT NULL,
+PRIMARY KEY (role_id, parent_id),
+FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+FOREIGN KEY (parent_id) REFERENCES roles (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+-- Services calling the policy decision endpoint need this permission, usually through an API key
+INSERT IGNORE INTO permissions (resource, endpoint, method, effect, description) VALUES
+('authorize', '/api/authorize', 'POST', 'allow', 'Ask for authorization decisions on behalf of other users');
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint = '/api/authorize'
+WHERE roles.name = 'ADMIN';
@@ -0,0 +1,12 @@
+-- role_grants and the role approval columns are created by GORM's AutoMigrate.
+-- Managing grants is granted to ADMIN only; requesting one needs no permission.
+INSERT IGNORE INTO permissions (resource, endpoint, method, effect, description) VALUES
+('role-grants', '/api/role-grants/*', 'GET', 'allow', 'List role grants and requests'),
+('role-grants', '/api/role-grants/*', 'POST', 'allow', 'Grant roles and approve or reject requests'),
+('role-grants', '/api/role-grants/*', 'DELETE', 'allow', 'Revoke role grants');
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint = '/api/role-grants/*'
+WHERE roles.name = 'ADMIN';
@@ -0,0 +1,47 @@
+-- reports, user_reports and role_reports are created by GORM's AutoMigrate.
+-- The legacy users.reports values are split like models.ParseReportCodes:
+-- codes separated by commas, semicolons, pipes or spaces, or a JSON array.
+CREATE TEMPORARY TABLE legacy_user_reports (
+user_id INT NOT NULL,
+code VARCHAR(100) NOT NULL
+);
+
+INSERT INTO legacy_user_reports (user_id, code)
+WITH RECURSIVE parts (user_id, code, rest) AS (
+SELECT id, SUBSTRING_INDEX(value, ',', 1), IF(LOCATE(',', value) > 0, SUBSTRING(value, LOCATE(',', value) + 1), NULL)
+FROM (
+SELECT id, REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(
+reports, ';', ','), '|', ','), ' ', ','), '\t', ','), '\n', ','), '\r', ','), '[', ','), ']', ','), '"', ',') AS value
+FROM users
+WHERE reports IS NOT NULL AND TRIM(reports) <> ''
+) AS legacy
+UNION ALL
+SELECT user_id, SUBSTRING_INDEX(rest, ',', 1), IF(LOCATE(',', rest) > 0, SUBSTRING(rest, LOCATE(',', rest) + 1), NULL)
+FROM parts
+WHERE rest IS NOT NULL
+)
+SELECT DISTINCT user_id, code FROM parts WHERE code <> '';
+
+-- Every code found becomes a catalogue entry named after it, to be renamed later
+INSERT IGNORE INTO reports (code, name, created_at, updated_at)
+SELECT DISTINCT code, code, NOW(), NOW() FROM legacy_user_reports;
+
+INSERT IGNORE INTO user_reports (user_id, report_id)
+SELECT legacy_user_reports.user_id, reports.id
+FROM legacy_user_reports
+JOIN reports ON reports.code = legacy_user_reports.code;
+
+DROP TEMPORARY TABLE legacy_user_reports;
+
+-- Managing the catalogue is granted to ADMIN only
+INSERT IGNORE INTO permissions (resource, endpoint, method, effect, description) VALUES
+('reports', '/api/reports/*', 'GET', 'allow', 'List and read reports'),
+('reports', '/api/reports/*', 'POST', 'allow', 'Create reports'),
+('reports', '/api/reports/*', 'PUT', 'allow', 'Update reports'),
+('reports', '/api/reports/*', 'DELETE', 'allow', 'Delete unassigned reports');
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint = '/api/reports/*'
+WHERE roles.name = 'ADMIN';
@@ -0,0 +1,48 @@
+-- warehouses and user_warehouses are created by GORM's AutoMigrate.
+-- The catalogue starts with every code found in users.warehouse and in the
+-- comma-separated users.other_warehouse, which becomes user_warehouses rows.
+CREATE TEMPORARY TABLE legacy_user_warehouses (
+user_id INT NOT NULL,
+code VARCHAR(100) NOT NULL
+);
+
+INSERT INTO legacy_user_warehouses (user_id, code)
+WITH RECURSIVE parts (user_id, code, rest) AS (
+SELECT id, SUBSTRING_INDEX(other_warehouse, ',', 1), IF(LOCATE(',', other_warehouse) > 0, SUBSTRING(other_warehouse, LOCATE(',', other_warehouse) + 1), NULL)
+FROM users
+WHERE other_warehouse IS NOT NULL AND TRIM(other_warehouse) <> ''
+UNION ALL
+SELECT user_id, SUBSTRING_INDEX(rest, ',', 1), IF(LOCATE(',', rest) > 0, SUBSTRING(rest, LOCATE(',', rest) + 1), NULL)
+FROM parts
+WHERE rest IS NOT NULL
+)
+SELECT DISTINCT user_id, TRIM(code) FROM parts WHERE TRIM(code) <> '';
+
+INSERT IGNORE INTO warehouses (code, name, created_at, updated_at)
+SELECT DISTINCT TRIM(warehouse), TRIM(warehouse), NOW(), NOW()
+FROM users
+WHERE warehouse IS NOT NULL AND TRIM(warehouse) <> '';
+
+INSERT IGNORE INTO warehouses (code, name, created_at, updated_at)
+SELECT DISTINCT code, code, NOW(), NOW() FROM legacy_user_warehouses;
+
+INSERT IGNORE INTO user_warehouses (user_id, warehouse_id)
+SELECT legacy_user_warehouses.user_id, warehouses.id
+FROM legacy_user_warehouses
+JOIN warehouses ON warehouses.code = legacy_user_warehouses.code;
+
+DROP TEMPORARY TABLE legacy_user_warehouses;
+
+-- Managing the catalogue is granted to ADMIN only; picking the active
+-- warehouse needs no permission
+INSERT IGNORE INTO permissions (resource, endpoint, method, effect, description) VALUES
+('warehouses', '/api/warehouses/*', 'GET', 'allow', 'List and read warehouses'),
+('warehouses', '/api/warehouses/*', 'POST', 'allow', 'Create warehouses'),
+('warehouses', '/api/warehouses/*', 'PUT', 'allow', 'Rename warehouses'),
+('warehouses', '/api/warehouses/*', 'DELETE', 'allow', 'Delete unassigned warehouses');
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint = '/api/warehouses/*'
+WHERE roles.name = 'ADMIN';
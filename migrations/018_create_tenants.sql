@@ -0,0 +1,30 @@
+-- tenants and the tenant_id columns of users, roles and permissions are
+-- created by GORM's AutoMigrate. Every existing record belongs to the default
+-- tenant, whose admins manage the other tenants.
+INSERT IGNORE INTO tenants (id, name, description, created_at, updated_at) VALUES
+(1, 'default', 'Organization of the records created before tenants', NOW(), NOW());
+
+UPDATE users SET tenant_id = 1 WHERE tenant_id IS NULL OR tenant_id = 0;
+UPDATE roles SET tenant_id = 1 WHERE tenant_id IS NULL OR tenant_id = 0;
+UPDATE permissions SET tenant_id = 1 WHERE tenant_id IS NULL OR tenant_id = 0;
+
+-- Role names and permissions are unique within their tenant only;
+-- idx_roles_tenant_name is added by AutoMigrate
+ALTER TABLE roles DROP INDEX name;
+ALTER TABLE permissions
+DROP INDEX unique_permission,
+ADD UNIQUE INDEX unique_permission (tenant_id, resource, endpoint, method);
+
+-- Tenant management is granted to the ADMIN of the default tenant only and is
+-- never copied to new tenants
+INSERT IGNORE INTO permissions (tenant_id, resource, endpoint, method, effect, description) VALUES
+(1, 'tenants', '/api/tenants/*', 'GET', 'allow', 'List and read tenants'),
+(1, 'tenants', '/api/tenants/*', 'POST', 'allow', 'Create tenants with their first admin'),
+(1, 'tenants', '/api/tenants/*', 'PUT', 'allow', 'Rename tenants'),
+(1, 'tenants', '/api/tenants/*', 'DELETE', 'allow', 'Delete tenants without users');
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.endpoint = '/api/tenants/*' AND permissions.tenant_id = roles.tenant_id
+WHERE roles.name = 'ADMIN' AND roles.tenant_id = 1;
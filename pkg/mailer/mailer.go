@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/j94veron/auth-service-insu/logger"
+	"go.uber.org/zap"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a Mailer that delivers through an SMTP server
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{
+		addr: host + ":" + port,
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg.String()))
+}
+
+type logMailer struct{}
+
+// NewLogMailer creates a Mailer that only logs the recipient and subject.
+// It is used when no SMTP server is configured.
+func NewLogMailer() Mailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(to, subject, body string) error {
+	logger.Logger.Warn("SMTP not configured, email not sent",
+		zap.String("to", to),
+		zap.String("subject", subject),
+	)
+	return nil
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -21,8 +22,43 @@ func NewClient(addr, password string, db int) *Client {
 	}
 }
 
+// SaveToken stores the token and tracks it in the user's session set, so all
+// the sessions of a user can be revoked at once
 func (c *Client) SaveToken(ctx context.Context, uuid string, userID uint, expiration time.Duration) error {
-	return c.client.Set(ctx, uuid, userID, expiration).Err()
+	if err := c.client.Set(ctx, uuid, userID, expiration).Err(); err != nil {
+		return err
+	}
+
+	key := userTokensKey(userID)
+	if err := c.client.SAdd(ctx, key, uuid).Err(); err != nil {
+		return err
+	}
+
+	// Keep the set alive as long as its longest-lived token
+	ttl, err := c.client.TTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if ttl < expiration {
+		return c.client.Expire(ctx, key, expiration).Err()
+	}
+	return nil
+}
+
+// RevokeUserTokens deletes every token saved for the user
+func (c *Client) RevokeUserTokens(ctx context.Context, userID uint) error {
+	key := userTokensKey(userID)
+	uuids, err := c.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := append(uuids, key)
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func userTokensKey(userID uint) string {
+	return "user_tokens:" + strconv.FormatUint(uint64(userID), 10)
 }
 
 func (c *Client) DeleteToken(ctx context.Context, uuid string) error {
@@ -36,3 +72,37 @@ func (c *Client) GetUserID(ctx context.Context, uuid string) (uint, error) {
 	}
 	return uint(val), nil
 }
+
+// SaveValue stores an arbitrary value under key with an expiration
+func (c *Client) SaveValue(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return c.client.Set(ctx, key, value, expiration).Err()
+}
+
+// ConsumeValue returns the value stored under key and deletes it, so it can only be read once
+func (c *Client) ConsumeValue(ctx context.Context, key string) (string, error) {
+	return c.client.GetDel(ctx, key).Result()
+}
+
+// Publish sends a message to every subscriber of the channel
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+	return c.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe calls handle with every message published to the channel until ctx is done
+func (c *Client) Subscribe(ctx context.Context, channel string, handle func(message string)) {
+	sub := c.client.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			handle(msg.Payload)
+		}
+	}
+}
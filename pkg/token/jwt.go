@@ -1,6 +1,7 @@
 package token
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -17,16 +18,76 @@ type TokenService struct {
 
 type TokenClaims struct {
 	jwt.StandardClaims
-	UserID         uint   `json:"user_id"`
-	Name           string `json:"name"`
-	LastName       string `json:"last_name"`
-	CommercialZone string `json:"commercial_zone"`
-	Warehouse      string `json:"warehouse"`
-	RoleID         uint   `json:"role_id"`
-	OtherWarehouse string `json:"other_warehouse"`
-	Province       string `json:"province"`
-	Reports        string `json:"reports"`
-	TokenUuid      string `json:"token_uuid"`
+	UserID          uint     `json:"user_id"`
+	TenantID        uint     `json:"tenant_id,omitempty"`
+	Name            string   `json:"name"`
+	LastName        string   `json:"last_name"`
+	CommercialZone  string   `json:"commercial_zone"`
+	Warehouse       string   `json:"warehouse"`
+	RoleID          uint     `json:"role_id"`
+	Roles           []uint   `json:"roles,omitempty"` // Every role of the user, role_id included
+	OtherWarehouse  string   `json:"other_warehouse"`
+	Province        string   `json:"province"`
+	ActiveWarehouse string   `json:"active_warehouse,omitempty"` // Site picked for the session; warehouse is then restricted to it
+	Reports         Reports  `json:"reports,omitempty"`          // Codes of the reports the user may see
+	Amr             []string `json:"amr,omitempty"`
+	Scope           string   `json:"scope,omitempty"` // Restricts what the token can be used for
+	TokenUuid       string   `json:"token_uuid"`
+	RefreshUuid     string   `json:"refresh_uuid,omitempty"` // Access tokens only: the refresh token of the same session
+}
+
+// RoleIDs returns the roles of the token, falling back to role_id for tokens
+// issued before users could have several roles
+func (c *TokenClaims) RoleIDs() []uint {
+	if len(c.Roles) > 0 {
+		return c.Roles
+	}
+	return []uint{c.RoleID}
+}
+
+// Tenant returns the tenant of the token, falling back to the default tenant
+// for tokens issued before tenants
+func (c *TokenClaims) Tenant() uint {
+	if c.TenantID == 0 {
+		return models.DefaultTenantID
+	}
+	return c.TenantID
+}
+
+// Reports is the reports claim. Tokens issued before the reports catalogue
+// carried the free-form reports string, which is still accepted.
+type Reports []string
+
+func (r *Reports) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*r = models.ParseReportCodes(legacy)
+		return nil
+	}
+	var codes []string
+	if err := json.Unmarshal(data, &codes); err != nil {
+		return err
+	}
+	*r = codes
+	return nil
+}
+
+// ScopePasswordChange limits a token to changing the user's own password
+const ScopePasswordChange = "password_change"
+
+// Authentication methods carried in the amr claim
+const (
+	AmrPassword  = "pwd"
+	AmrEmail     = "email"
+	AmrFederated = "fed"
+	AmrOTP       = "otp"
+)
+
+// ActionClaims are the claims of single-purpose tokens such as magic links
+type ActionClaims struct {
+	jwt.StandardClaims
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
 }
 
 // NewTokenService creates a new instance of TokenService
@@ -42,8 +103,20 @@ func (t *TokenService) GenerateTokens(user *models.User) (*models.TokenDetail, e
 	return t.CreateTokens(user)
 }
 
-// CreateTokens creates the actual tokens with claims
-func (t *TokenService) CreateTokens(user *models.User) (*models.TokenDetail, error) {
+// CreateTokens creates the actual tokens with claims. amr lists the
+// authentication methods used to log in and is kept across refreshes.
+func (t *TokenService) CreateTokens(user *models.User, amr ...string) (*models.TokenDetail, error) {
+	return t.createTokens(user, "", amr)
+}
+
+// CreateWarehouseTokens creates tokens whose warehouse claim is restricted to
+// one site of the user. The site is kept in the refresh token so that
+// refreshes keep the restriction.
+func (t *TokenService) CreateWarehouseTokens(user *models.User, warehouse string, amr ...string) (*models.TokenDetail, error) {
+	return t.createTokens(user, warehouse, amr)
+}
+
+func (t *TokenService) createTokens(user *models.User, activeWarehouse string, amr []string) (*models.TokenDetail, error) {
 	td := &models.TokenDetail{}
 	now := time.Now()
 
@@ -55,22 +128,32 @@ func (t *TokenService) CreateTokens(user *models.User) (*models.TokenDetail, err
 	td.AccessUuid = uuid.New().String()
 	td.RefreshUuid = uuid.New().String()
 
+	warehouse, otherWarehouse := user.Warehouse, user.OtherWarehouseCodes()
+	if activeWarehouse != "" {
+		warehouse, otherWarehouse = activeWarehouse, ""
+	}
+
 	// Create access token
 	atClaims := TokenClaims{
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: td.AtExpires.Unix(),
 			IssuedAt:  now.Unix(),
 		},
-		UserID:         user.ID,
-		Name:           user.Name,
-		LastName:       user.LastName,
-		CommercialZone: user.CommercialZone,
-		Warehouse:      user.Warehouse,
-		OtherWarehouse: user.OtherWarehouse,
-		Province:       user.Province,
-		RoleID:         user.RoleID,
-		Reports:        user.Reports,
-		TokenUuid:      td.AccessUuid,
+		UserID:          user.ID,
+		TenantID:        user.TenantID,
+		Name:            user.Name,
+		LastName:        user.LastName,
+		CommercialZone:  user.CommercialZone,
+		Warehouse:       warehouse,
+		OtherWarehouse:  otherWarehouse,
+		ActiveWarehouse: activeWarehouse,
+		Province:        user.Province,
+		RoleID:          user.RoleID,
+		Roles:           user.EffectiveRoleIDs(now),
+		Reports:         user.ReportCodes(now),
+		Amr:             amr,
+		TokenUuid:       td.AccessUuid,
+		RefreshUuid:     td.RefreshUuid,
 	}
 
 	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
@@ -86,8 +169,10 @@ func (t *TokenService) CreateTokens(user *models.User) (*models.TokenDetail, err
 			ExpiresAt: td.RtExpires.Unix(),
 			IssuedAt:  now.Unix(),
 		},
-		UserID:    user.ID,
-		TokenUuid: td.RefreshUuid,
+		UserID:          user.ID,
+		Amr:             amr,
+		ActiveWarehouse: activeWarehouse,
+		TokenUuid:       td.RefreshUuid,
 	}
 
 	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
@@ -99,6 +184,40 @@ func (t *TokenService) CreateTokens(user *models.User) (*models.TokenDetail, err
 	return td, nil
 }
 
+// CreateRestrictedToken creates a short-lived access token limited to scope,
+// without a refresh token
+func (t *TokenService) CreateRestrictedToken(user *models.User, scope string) (*models.TokenDetail, error) {
+	now := time.Now()
+	td := &models.TokenDetail{
+		AtExpires:  now.Add(10 * time.Minute),
+		AccessUuid: uuid.New().String(),
+		Scope:      scope,
+	}
+
+	claims := TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: td.AtExpires.Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		Name:      user.Name,
+		LastName:  user.LastName,
+		RoleID:    user.RoleID,
+		Roles:     user.EffectiveRoleIDs(now),
+		Scope:     scope,
+		TokenUuid: td.AccessUuid,
+	}
+
+	var err error
+	td.AccessToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(t.accessSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
 // VerifyToken checks if a token is valid
 func (t *TokenService) VerifyToken(tokenString string, isRefresh bool) (*TokenClaims, error) {
 	secret := t.accessSecret
@@ -136,3 +255,52 @@ func (t *TokenService) ValidateRefreshToken(tokenString string) (claims *TokenCl
 	}
 	return claims, nil
 }
+
+// CreateActionToken creates a short-lived token bound to a single purpose.
+// It returns the signed token and its ID, which callers use to make it single-use.
+func (t *TokenService) CreateActionToken(purpose string, userID uint, ttl time.Duration) (string, string, error) {
+	now := time.Now()
+	id := uuid.New().String()
+
+	claims := ActionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			ExpiresAt: now.Add(ttl).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		UserID:  userID,
+		Purpose: purpose,
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.actionKey(purpose))
+	if err != nil {
+		return "", "", err
+	}
+	return signed, id, nil
+}
+
+// VerifyActionToken checks an action token created for the given purpose
+func (t *TokenService) VerifyActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ActionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return t.actionKey(purpose), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*ActionClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
+
+// actionKey derives a signing key per purpose, so action tokens can never be
+// accepted as access tokens or for a different purpose
+func (t *TokenService) actionKey(purpose string) []byte {
+	return []byte(t.accessSecret + ":" + purpose)
+}